@@ -0,0 +1,124 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type AccessLogFormat int
+
+const (
+	CommonLogFormat AccessLogFormat = iota
+	CombinedLogFormat
+	JSONLogFormat
+)
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+type accessLogEntry struct {
+	RemoteIP  string  `json:"remote_ip"`
+	User      string  `json:"user,omitempty"`
+	Time      string  `json:"time"`
+	Method    string  `json:"method"`
+	URI       string  `json:"uri"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+	Duration  float64 `json:"duration_ms"`
+}
+
+func AccessLog(out io.Writer, format AccessLogFormat) Middleware {
+	var mu sync.Mutex
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, c *Context) {
+			start := time.Now()
+			next(w, r, c)
+
+			status := c.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			user := "-"
+			if u, _, ok := r.BasicAuth(); ok && u != "" {
+				user = u
+			}
+
+			line := formatAccessLog(format, accessLogEntry{
+				RemoteIP:  c.clientIP(r),
+				User:      user,
+				Time:      start.Format(clfTimeLayout),
+				Method:    r.Method,
+				URI:       r.RequestURI,
+				Proto:     r.Proto,
+				Status:    status,
+				Bytes:     c.writer.written,
+				Referer:   r.Referer(),
+				UserAgent: r.UserAgent(),
+				Duration:  float64(time.Since(start).Microseconds()) / 1000,
+			})
+
+			mu.Lock()
+			_, _ = out.Write(line)
+			mu.Unlock()
+		}
+	}
+}
+
+func formatAccessLog(format AccessLogFormat, e accessLogEntry) []byte {
+	if e.URI == "" {
+		e.URI = "/"
+	}
+
+	if format == JSONLogFormat {
+		if e.User == "-" {
+			e.User = ""
+		}
+		b, _ := json.Marshal(e)
+		return append(b, '\n')
+	}
+
+	b := make([]byte, 0, 256)
+	b = append(b, e.RemoteIP...)
+	b = append(b, " - "...)
+	b = append(b, e.User...)
+	b = append(b, " ["...)
+	b = append(b, e.Time...)
+	b = append(b, "] \""...)
+	b = append(b, e.Method...)
+	b = append(b, ' ')
+	b = append(b, e.URI...)
+	b = append(b, ' ')
+	b = append(b, e.Proto...)
+	b = append(b, "\" "...)
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, ' ')
+	if e.Bytes > 0 {
+		b = strconv.AppendInt(b, e.Bytes, 10)
+	} else {
+		b = append(b, '-')
+	}
+
+	if format == CombinedLogFormat {
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(e.Referer))
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(e.UserAgent))
+	}
+
+	return append(b, '\n')
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
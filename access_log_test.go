@@ -0,0 +1,84 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var combinedLogRe = regexp.MustCompile(`^(\S+) - (\S+) \[([^\]]+)\] "(\S+) (\S+) (\S+)" (\d{3}) (\d+|-) "([^"]*)" "([^"]*)"$`)
+
+func serveWithAccessLog(format AccessLogFormat, req *http.Request) string {
+	var buf bytes.Buffer
+
+	r := NewRouter().(*Router)
+	r.Use(AccessLog(&buf, format))
+	r.HandleFunc("/items/<id:isDigits>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return buf.String()
+}
+
+func TestAccessLogCombinedFormat(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/items/7?full=1", nil)
+	req.RemoteAddr = "203.0.113.9:4321"
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.SetBasicAuth("bob", "secret")
+
+	line := strings.TrimSuffix(serveWithAccessLog(CombinedLogFormat, req), "\n")
+	m := combinedLogRe.FindStringSubmatch(line)
+	if m == nil {
+		t.Fatalf("line does not match combined log format: %q", line)
+	}
+
+	want := map[int]string{
+		1:  "203.0.113.9",
+		2:  "bob",
+		4:  "GET",
+		5:  "/items/7?full=1",
+		6:  "HTTP/1.1",
+		7:  "202",
+		8:  "5",
+		9:  "https://example.com/",
+		10: "curl/8.0",
+	}
+	for i, v := range want {
+		if m[i] != v {
+			t.Errorf("field %d = %q, want %q", i, m[i], v)
+		}
+	}
+
+	if _, err := time.Parse(clfTimeLayout, m[3]); err != nil {
+		t.Errorf("timestamp %q is not in CLF layout: %v", m[3], err)
+	}
+}
+
+func TestAccessLogCommonAndJSONFormats(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+	req.RemoteAddr = "203.0.113.9:4321"
+
+	common := serveWithAccessLog(CommonLogFormat, req)
+	if !strings.HasPrefix(common, "203.0.113.9 - - [") || !strings.HasSuffix(common, `"GET /items/7 HTTP/1.1" 202 5`+"\n") {
+		t.Errorf("unexpected common log line: %q", common)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/items/7", nil)
+	req.RemoteAddr = "203.0.113.9:4321"
+
+	var entry accessLogEntry
+	if err := json.Unmarshal([]byte(serveWithAccessLog(JSONLogFormat, req)), &entry); err != nil {
+		t.Fatalf("invalid JSON log line: %v", err)
+	}
+	if entry.RemoteIP != "203.0.113.9" || entry.Status != 202 || entry.Bytes != 5 || entry.URI != "/items/7" {
+		t.Errorf("unexpected JSON entry: %+v", entry)
+	}
+}
@@ -0,0 +1,220 @@
+package router
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrBindTarget = errors.New("router: bind target must be a non-nil pointer to a struct")
+
+var MaxMultipartMemory int64 = 32 << 20
+
+type BindError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("router: cannot bind %q to %s: %v", e.Value, e.Field, e.Err)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType     = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+func BindQuery(r *http.Request, v any) error {
+	return bindValues(r.URL.Query(), nil, "query", v)
+}
+
+func BindForm(r *http.Request, v any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var files map[string][]*multipart.FileHeader
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(MaxMultipartMemory); err != nil {
+			return err
+		}
+		files = r.MultipartForm.File
+	} else if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	return bindValues(r.PostForm, files, "form", v)
+}
+
+func bindValues(values url.Values, files map[string][]*multipart.FileHeader, tag string, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrBindTarget
+	}
+
+	var errs []error
+	bindStruct(rv.Elem(), values, files, tag, &errs)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return ValidateStruct(v)
+}
+
+func bindStruct(sv reflect.Value, values url.Values, files map[string][]*multipart.FileHeader, tag string, errs *[]error) {
+	st := sv.Type()
+
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		fv := sv.Field(i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			bindStruct(fv, values, files, tag, errs)
+			continue
+		}
+
+		name := sf.Tag.Get(tag)
+		if name == "" || name == "-" || !sf.IsExported() {
+			continue
+		}
+
+		switch sf.Type {
+		case fileHeaderType:
+			if fh := files[name]; len(fh) > 0 {
+				fv.Set(reflect.ValueOf(fh[0]))
+			}
+			continue
+		case fileHeadersType:
+			if fh, ok := files[name]; ok {
+				fv.Set(reflect.ValueOf(fh))
+			}
+			continue
+		}
+
+		raw, ok := values[name]
+		if !ok {
+			def, hasDefault := sf.Tag.Lookup("default")
+			if !hasDefault {
+				continue
+			}
+			raw = []string{def}
+			if fv.Kind() == reflect.Slice && !fv.Addr().Type().Implements(textUnmarshalerType) {
+				raw = strings.Split(def, ",")
+			}
+		}
+
+		if err := setField(fv, raw); err != nil {
+			*errs = append(*errs, &BindError{Field: name, Value: strings.Join(raw, ","), Err: err})
+		}
+	}
+}
+
+func setField(fv reflect.Value, raw []string) error {
+	if fv.Kind() == reflect.Slice && !fv.Addr().Type().Implements(textUnmarshalerType) {
+		out := reflect.MakeSlice(fv.Type(), len(raw), len(raw))
+		for i, s := range raw {
+			if err := setScalar(out.Index(i), s); err != nil {
+				return err
+			}
+		}
+		fv.Set(out)
+		return nil
+	}
+
+	if len(raw) == 0 {
+		return nil
+	}
+	return setScalar(fv, raw[0])
+}
+
+func setScalar(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Pointer {
+		p := reflect.New(fv.Type().Elem())
+		if err := setScalar(p.Elem(), s); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+
+	if tu, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return tu.UnmarshalText([]byte(s))
+	}
+
+	if fv.Type() == durationType {
+		if s == "" {
+			fv.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		switch strings.ToLower(s) {
+		case "":
+			fv.SetBool(false)
+		case "on":
+			fv.SetBool(true)
+		default:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return err
+			}
+			fv.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			fv.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			fv.SetUint(0)
+			return nil
+		}
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			fv.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+
+	return nil
+}
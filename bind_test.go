@@ -0,0 +1,168 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pagination struct {
+	Page    int `query:"page" default:"1"`
+	PerPage int `query:"per_page" default:"20"`
+}
+
+type productFilter struct {
+	pagination
+	Search   string        `query:"q"`
+	Tags     []string      `query:"tag"`
+	InStock  bool          `query:"in_stock"`
+	MaxPrice *float64      `query:"max_price"`
+	Sort     *string       `query:"sort"`
+	Since    time.Time     `query:"since"`
+	Timeout  time.Duration `query:"timeout" default:"5s"`
+	Sizes    []int         `query:"size" default:"1,2"`
+	internal string        `query:"internal"`
+}
+
+func TestBindQuery(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/products?q=shoe&tag=red&tag=sale&in_stock=true&max_price=19.5&sort=&since=2026-01-02T00:00:00Z&page=3&internal=x", nil)
+
+	var f productFilter
+	if err := BindQuery(req, &f); err != nil {
+		t.Fatalf("BindQuery: %v", err)
+	}
+
+	if f.Search != "shoe" || len(f.Tags) != 2 || f.Tags[1] != "sale" || !f.InStock {
+		t.Fatalf("unexpected scalar/slice binding: %+v", f)
+	}
+	if f.MaxPrice == nil || *f.MaxPrice != 19.5 {
+		t.Fatalf("expected max_price 19.5, got %v", f.MaxPrice)
+	}
+	if f.Sort == nil || *f.Sort != "" {
+		t.Fatalf("expected an empty but present sort, got %v", f.Sort)
+	}
+	if !f.Since.Equal(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected since to be parsed, got %v", f.Since)
+	}
+	if f.Page != 3 || f.PerPage != 20 || f.Timeout != 5*time.Second || len(f.Sizes) != 2 || f.Sizes[1] != 2 {
+		t.Fatalf("expected embedded fields and defaults, got %+v", f)
+	}
+	if f.internal != "" {
+		t.Fatal("unexported fields must not be bound")
+	}
+}
+
+func TestBindQueryMissingVersusEmpty(t *testing.T) {
+	var missing, empty pagination
+
+	if err := BindQuery(httptest.NewRequest(http.MethodGet, "/", nil), &missing); err != nil {
+		t.Fatal(err)
+	}
+	if err := BindQuery(httptest.NewRequest(http.MethodGet, "/?page=&per_page=", nil), &empty); err != nil {
+		t.Fatal(err)
+	}
+
+	if missing.Page != 1 || missing.PerPage != 20 {
+		t.Fatalf("expected defaults for missing keys, got %+v", missing)
+	}
+	if empty.Page != 0 || empty.PerPage != 0 {
+		t.Fatalf("expected present-but-empty keys to skip defaults, got %+v", empty)
+	}
+}
+
+func TestBindQueryErrors(t *testing.T) {
+	var f productFilter
+	req := httptest.NewRequest(http.MethodGet, "/?page=two&in_stock=maybe", nil)
+
+	err := BindQuery(req, &f)
+
+	var be *BindError
+	if !errors.As(err, &be) || be.Field != "page" || be.Value != "two" || !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("expected a BindError for page, got %v", err)
+	}
+	if got := err.Error(); got != "router: cannot bind \"two\" to page: strconv.ParseInt: parsing \"two\": invalid syntax\n"+
+		"router: cannot bind \"maybe\" to in_stock: strconv.ParseBool: parsing \"maybe\": invalid syntax" {
+		t.Fatalf("unexpected error text: %q", got)
+	}
+
+	if err := BindQuery(req, f); !errors.Is(err, ErrBindTarget) {
+		t.Fatalf("expected ErrBindTarget for a non-pointer, got %v", err)
+	}
+}
+
+type signupForm struct {
+	Name     string                  `form:"name"`
+	Age      int                     `form:"age"`
+	Terms    bool                    `form:"terms"`
+	Role     string                  `form:"role" default:"member"`
+	Avatar   *multipart.FileHeader   `form:"avatar"`
+	Attached []*multipart.FileHeader `form:"attachment"`
+}
+
+func TestBindFormURLEncoded(t *testing.T) {
+	body := strings.NewReader("name=Ada&age=36&terms=on")
+	req := httptest.NewRequest(http.MethodPost, "/signup?name=ignored", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var f signupForm
+	if err := BindForm(req, &f); err != nil {
+		t.Fatalf("BindForm: %v", err)
+	}
+
+	if f.Name != "Ada" || f.Age != 36 || !f.Terms || f.Role != "member" || f.Avatar != nil {
+		t.Fatalf("unexpected form binding: %+v", f)
+	}
+}
+
+func TestBindFormMultipart(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	_ = mw.WriteField("name", "Grace")
+	_ = mw.WriteField("role", "admin")
+	fw, _ := mw.CreateFormFile("avatar", "me.png")
+	_, _ = fw.Write(bytes.Repeat([]byte{0x89}, 512))
+	for _, name := range []string{"a.txt", "b.txt"} {
+		fw, _ := mw.CreateFormFile("attachment", name)
+		_, _ = fw.Write([]byte(name))
+	}
+	_ = mw.Close()
+
+	old := MaxMultipartMemory
+	MaxMultipartMemory = 64
+	defer func() { MaxMultipartMemory = old }()
+
+	req := httptest.NewRequest(http.MethodPost, "/signup", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var f signupForm
+	if err := BindForm(req, &f); err != nil {
+		t.Fatalf("BindForm: %v", err)
+	}
+	defer func() { _ = req.MultipartForm.RemoveAll() }()
+
+	if f.Name != "Grace" || f.Role != "admin" {
+		t.Fatalf("unexpected values: %+v", f)
+	}
+	if f.Avatar == nil || f.Avatar.Filename != "me.png" || f.Avatar.Size != 512 {
+		t.Fatalf("unexpected avatar: %+v", f.Avatar)
+	}
+	if len(f.Attached) != 2 || f.Attached[1].Filename != "b.txt" {
+		t.Fatalf("unexpected attachments: %+v", f.Attached)
+	}
+
+	file, err := f.Avatar.Open()
+	if err != nil {
+		t.Fatalf("opening an upload spilled past the memory limit: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+	if _, ok := file.(*os.File); !ok {
+		t.Fatalf("expected the avatar to be stored on disk with a 64 byte limit, got %T", file)
+	}
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+type ConnStats struct {
+	New      int64
+	Active   int64
+	Idle     int64
+	Closed   int64
+	Hijacked int64
+}
+
+type connTracker struct {
+	states   sync.Map
+	accepted atomic.Int64
+	active   atomic.Int64
+	idle     atomic.Int64
+	closed   atomic.Int64
+	hijacked atomic.Int64
+}
+
+func (t *connTracker) track(c net.Conn, state http.ConnState) {
+	if prev, ok := t.states.Load(c); ok {
+		switch prev.(http.ConnState) {
+		case http.StateActive:
+			t.active.Add(-1)
+		case http.StateIdle:
+			t.idle.Add(-1)
+		}
+	}
+
+	switch state {
+	case http.StateNew:
+		t.accepted.Add(1)
+		t.states.Store(c, state)
+	case http.StateActive:
+		t.active.Add(1)
+		t.states.Store(c, state)
+	case http.StateIdle:
+		t.idle.Add(1)
+		t.states.Store(c, state)
+	case http.StateHijacked:
+		t.hijacked.Add(1)
+		t.states.Delete(c)
+	case http.StateClosed:
+		t.closed.Add(1)
+		t.states.Delete(c)
+	}
+}
+
+func (t *connTracker) snapshot() ConnStats {
+	return ConnStats{
+		New:      t.accepted.Load(),
+		Active:   t.active.Load(),
+		Idle:     t.idle.Load(),
+		Closed:   t.closed.Load(),
+		Hijacked: t.hijacked.Load(),
+	}
+}
+
+func (r *Router) ConnStats() ConnStats {
+	return r.conns.snapshot()
+}
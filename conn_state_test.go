@@ -0,0 +1,68 @@
+package router
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func waitForConnStats(t *testing.T, r *Router, ok func(ConnStats) bool) ConnStats {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats := r.ConnStats()
+		if ok(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connection stats did not reach expected state: %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConnStats(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.HandleFunc("/ping", "GET", handlerWithID("pong"))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	srv := r.newServer(Listener{})
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	defer func() {
+		_ = srv.Close()
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+ln.Addr().String()+"/ping", nil)
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	waitForConnStats(t, r, func(s ConnStats) bool {
+		return s.New == 1 && s.Idle == 1 && s.Active == 0
+	})
+
+	_ = conn.Close()
+
+	waitForConnStats(t, r, func(s ConnStats) bool {
+		return s.Closed == 1 && s.Idle == 0 && s.Active == 0
+	})
+}
@@ -1,7 +1,13 @@
 package router
 
 import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Par struct {
@@ -18,9 +24,75 @@ type Context struct {
 	Segments []Seg
 	Data     map[string]any
 	Entries  []RouteEntry
+	Request  *http.Request
 
 	paramMap map[string]string
+	route    string
 	aborted  bool
+	released bool
+	router   *Router
+	writer   statusRecorder
+
+	onComplete []func()
+	search     []searchFrame
+	leaves     []*RadixNode
+}
+
+func (c *Context) OnComplete(fn func()) {
+	c.onComplete = append(c.onComplete, fn)
+}
+
+func (c *Context) Status() int {
+	return c.writer.status
+}
+
+func (c *Context) runComplete() {
+	for i := len(c.onComplete) - 1; i >= 0; i-- {
+		c.runCompleteHook(c.onComplete[i])
+	}
+}
+
+func (c *Context) runCompleteHook(fn func()) {
+	defer func() {
+		if m := recover(); m != nil && c.router != nil {
+			c.router.logPanic(c.Request, c, m)
+		}
+	}()
+
+	fn()
+}
+
+func (c *Context) Route() string {
+	return c.route
+}
+
+func (c *Context) RequestID() string {
+	return c.requestValue(ContextKeyRequestID)
+}
+
+func (c *Context) RealIP() string {
+	return c.requestValue(ContextKeyRealIP)
+}
+
+func (c *Context) requestValue(key ctxKey) string {
+	if c.Request != nil {
+		if v, ok := c.Request.Context().Value(key).(string); ok && v != "" {
+			return v
+		}
+	}
+	v, _ := c.Get(string(key)).(string)
+	return v
+}
+
+func (c *Context) setRequestValue(r *http.Request, key ctxKey, value string) *http.Request {
+	r = r.WithContext(context.WithValue(r.Context(), key, value))
+	c.Request = r
+	c.Set(string(key), value)
+	return r
+}
+
+func (c *Context) Req() *http.Request {
+	return c.Request
 }
 
 func (c *Context) Abort() {
@@ -31,6 +103,16 @@ func (c *Context) Aborted() bool {
 	return c.aborted
 }
 
+func (c *Context) AbortWithStatus(w http.ResponseWriter, code int) {
+	c.aborted = true
+	http.Error(w, http.StatusText(code), code)
+}
+
+func (c *Context) AbortWithJSON(w http.ResponseWriter, code int, v any) {
+	c.aborted = true
+	JSON(w, code, v)
+}
+
 func (c *Context) Set(key string, value any) {
 	if c.Data == nil {
 		c.Data = make(map[string]any, 4)
@@ -45,6 +127,48 @@ func (c *Context) Get(key string) any {
 	return c.Data[key]
 }
 
+func GetTyped[T any](c *Context, key string) (T, bool) {
+	v, ok := c.Get(key).(T)
+	return v, ok
+}
+
+func (c *Context) GetString(key string) string {
+	v, _ := GetTyped[string](c, key)
+	return v
+}
+
+func (c *Context) GetInt(key string) int {
+	v, _ := GetTyped[int](c, key)
+	return v
+}
+
+func (c *Context) GetBool(key string) bool {
+	v, _ := GetTyped[bool](c, key)
+	return v
+}
+
+func (c *Context) splitSegments(path string) bool {
+	start := -1
+
+	for j := 0; j < len(path); j++ {
+		if path[j] != '/' {
+			if start == -1 {
+				start = j
+			}
+		} else if start != -1 {
+			c.Segments = append(c.Segments, Seg{path[start:j]})
+			start = -1
+		}
+	}
+
+	if start == -1 {
+		return false
+	}
+
+	c.Segments = append(c.Segments, Seg{path[start:]})
+	return true
+}
+
 func (c *Context) SetParams() {
 	if len(c.Params) > 0 {
 		return
@@ -75,6 +199,29 @@ func (c *Context) SetParams() {
 			Key:   p.Slug,
 			Value: segment,
 		})
+
+		if p.Type == _SUBMATCH {
+			c.appendSubmatches(p, segment)
+		}
+	}
+}
+
+func (c *Context) appendSubmatches(p Pattern, segment string) {
+	matches := p.RegexCompiled.FindStringSubmatch(segment)
+	if matches == nil {
+		return
+	}
+
+	names := p.RegexCompiled.SubexpNames()
+	for i := 1; i < len(matches); i++ {
+		key := names[i]
+		if key == "" {
+			key = p.Slug + "." + strconv.Itoa(i)
+		}
+		c.Params = append(c.Params, Par{
+			Key:   key,
+			Value: matches[i],
+		})
 	}
 }
 
@@ -108,9 +255,110 @@ func (c *Context) ParamMap() map[string]string {
 	return c.paramMap
 }
 
+func (c *Context) ParamDate(key string, layout string) (time.Time, bool) {
+	v, ok := c.Param(key)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if layout == "" {
+		layout = time.DateOnly
+	}
+
+	t, err := time.Parse(layout, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (c *Context) Deadline() (time.Time, bool) {
+	if c.Request == nil {
+		return time.Time{}, false
+	}
+	return c.Request.Context().Deadline()
+}
+
+func (c *Context) Done() <-chan struct{} {
+	if c.Request == nil {
+		return nil
+	}
+	return c.Request.Context().Done()
+}
+
+func (c *Context) Err() error {
+	if c.Request == nil {
+		return nil
+	}
+	return c.Request.Context().Err()
+}
+
+func (c *Context) clientIP(r *http.Request) string {
+	if c.router == nil {
+		return peerIP(r)
+	}
+	return c.router.clientIP(r)
+}
+
+func (c *Context) ShutdownDeadline() (time.Time, bool) {
+	if c.router == nil {
+		return time.Time{}, false
+	}
+	return c.router.ShutdownDeadline()
+}
+
+func (c *Context) SafeRedirect(w http.ResponseWriter, req *http.Request, status int, target string, allowedHosts ...string) bool {
+	if !isSafeRedirect(target, allowedHosts) {
+		http.Error(w, "invalid redirect target", http.StatusBadRequest)
+		return false
+	}
+
+	if status < 300 || status > 399 {
+		status = http.StatusFound
+	}
+
+	http.Redirect(w, req, target, status)
+	return true
+}
+
+func isSafeRedirect(target string, allowedHosts []string) bool {
+	if target == "" || strings.ContainsAny(target, "\\\r\n\t") {
+		return false
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+
+	if u.Scheme == "" && u.Host == "" && !strings.HasPrefix(target, "//") {
+		return true
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+	for _, h := range allowedHosts {
+		h = strings.ToLower(h)
+		if h == host || h == hostname {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (c *Context) reset() {
 	c.aborted = false
 	c.paramMap = nil
+	c.route = ""
+	c.router = nil
+	c.Request = nil
+	c.writer.reset(nil)
+	c.onComplete = c.onComplete[:0]
 
 	if cap(c.Params) > 1024 {
 		c.Params = make([]Par, 0, 8)
@@ -124,13 +372,20 @@ func (c *Context) reset() {
 		c.Segments = c.Segments[:0]
 	}
 
+	clear(c.leaves)
+	c.leaves = c.leaves[:0]
+
 	if cap(c.Entries) > 1024 {
 		c.Entries = make([]RouteEntry, 0, 8)
 	} else {
 		c.Entries = c.Entries[:0]
 	}
 
-	c.Data = nil
+	if c.Data == nil || len(c.Data) > 64 {
+		c.Data = make(map[string]any, 4)
+	} else {
+		clear(c.Data)
+	}
 }
 
 var contextPool = sync.Pool{
@@ -147,9 +402,14 @@ var contextPool = sync.Pool{
 func GetContext() *Context {
 	ctx := contextPool.Get().(*Context)
 	ctx.reset()
+	ctx.released = false
 	return ctx
 }
 
 func PutContext(ctx *Context) {
+	if ctx == nil || ctx.released {
+		return
+	}
+	ctx.released = true
 	contextPool.Put(ctx)
 }
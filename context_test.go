@@ -1,7 +1,14 @@
 package router
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestContextSetAndGet(t *testing.T) {
@@ -21,6 +28,35 @@ func TestContextSetAndGet(t *testing.T) {
 	}
 }
 
+func TestContextGetTyped(t *testing.T) {
+	ctx := &Context{}
+
+	if v, ok := GetTyped[string](ctx, "user"); ok || v != "" {
+		t.Fatalf("expected a miss on an empty context, got %q %v", v, ok)
+	}
+
+	ctx.Set("user", "ada")
+	ctx.Set("attempts", 3)
+	ctx.Set("admin", true)
+	ctx.Set("deadline", time.Second)
+
+	if v, ok := GetTyped[string](ctx, "user"); !ok || v != "ada" {
+		t.Fatalf("expected ada, got %q %v", v, ok)
+	}
+	if v, ok := GetTyped[int](ctx, "user"); ok || v != 0 {
+		t.Fatalf("expected a type mismatch to return the zero value, got %d %v", v, ok)
+	}
+	if v, ok := GetTyped[time.Duration](ctx, "deadline"); !ok || v != time.Second {
+		t.Fatalf("expected 1s, got %v %v", v, ok)
+	}
+	if ctx.GetString("user") != "ada" || ctx.GetInt("attempts") != 3 || !ctx.GetBool("admin") {
+		t.Fatal("typed getters returned unexpected values")
+	}
+	if ctx.GetString("attempts") != "" || ctx.GetInt("missing") != 0 || ctx.GetBool("user") {
+		t.Fatal("typed getters must return the zero value on a miss or mismatch")
+	}
+}
+
 func TestContextParam(t *testing.T) {
 	ctx := &Context{
 		Params: []Par{
@@ -42,6 +78,33 @@ func TestContextParam(t *testing.T) {
 	}
 }
 
+func TestContextParamDate(t *testing.T) {
+	ctx := &Context{
+		Params: []Par{
+			{"day", "2024-02-29"},
+			{"bad", "2023-02-29"},
+			{"eu", "29.02.2024"},
+		},
+	}
+
+	d, ok := ctx.ParamDate("day", "")
+	if !ok || !d.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf(`expected ParamDate("day") = 2024-02-29, got %v (ok=%v)`, d, ok)
+	}
+
+	if d, ok := ctx.ParamDate("eu", "02.01.2006"); !ok || d.Day() != 29 {
+		t.Errorf(`expected ParamDate("eu") with custom layout to parse, got %v (ok=%v)`, d, ok)
+	}
+
+	if d, ok := ctx.ParamDate("bad", ""); ok || !d.IsZero() {
+		t.Errorf(`expected ParamDate("bad") to fail, got %v (ok=%v)`, d, ok)
+	}
+
+	if d, ok := ctx.ParamDate("missing", ""); ok || !d.IsZero() {
+		t.Errorf(`expected ParamDate("missing") to fail, got %v (ok=%v)`, d, ok)
+	}
+}
+
 func TestContextReset(t *testing.T) {
 	ctx := &Context{
 		Params: []Par{{"a", "1"}, {"b", "2"}},
@@ -61,8 +124,55 @@ func TestContextReset(t *testing.T) {
 	if len(ctx.Segments) != 0 {
 		t.Errorf("expected Segments to be empty after reset, got %d", len(ctx.Segments))
 	}
-	if ctx.Data != nil {
-		t.Error("expected Data to be nil after reset")
+	if ctx.Data == nil || len(ctx.Data) != 0 {
+		t.Errorf("expected Data to be empty but allocated after reset, got %v", ctx.Data)
+	}
+}
+
+func TestContextResetReusesData(t *testing.T) {
+	ctx := &Context{Data: map[string]any{"key": "value"}}
+	data := ctx.Data
+
+	ctx.reset()
+	ctx.Set("other", 1)
+
+	if len(data) != 1 || data["other"] != 1 {
+		t.Fatal("expected reset to clear and reuse the Data map")
+	}
+
+	for i := 0; i < 100; i++ {
+		ctx.Set(strconv.Itoa(i), i)
+	}
+	data = ctx.Data
+	ctx.reset()
+	ctx.Set("other", 1)
+
+	if len(data) == 1 {
+		t.Fatal("expected an oversized Data map to be replaced instead of reused")
+	}
+}
+
+func TestParamMapDoesNotLeakBetweenRequests(t *testing.T) {
+	r := NewRouter().(*Router)
+	seen := map[string]int{}
+	record := func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		seen[req.URL.Path] = len(ctx.ParamMap())
+		if _, ok := ctx.Param("id"); ok && req.URL.Path != "/users/7" {
+			t.Errorf("%s: stale id param", req.URL.Path)
+		}
+	}
+	r.HandleFunc("/users/<id:isDigits>", "GET", record)
+	r.HandleFunc("/health", "GET", record)
+	r.HandleFunc("/teams/<team:isDigits>", "GET", record)
+
+	for i := 0; i < 50; i++ {
+		for _, path := range []string{"/users/7", "/health", "/teams/3"} {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+	}
+
+	if seen["/users/7"] != 1 || seen["/health"] != 0 || seen["/teams/3"] != 1 {
+		t.Fatalf("unexpected param maps: %v", seen)
 	}
 }
 
@@ -87,3 +197,253 @@ func TestGetContextAndPutContext(t *testing.T) {
 		t.Errorf("expected Data to be reset, got %v", ctx2.Get("x"))
 	}
 }
+
+func TestPutContextIsIdempotent(t *testing.T) {
+	ctx := GetContext()
+	PutContext(ctx)
+	PutContext(ctx)
+	PutContext(nil)
+
+	c1, c2 := GetContext(), GetContext()
+	if c1 == c2 {
+		t.Fatal("a context put twice must only enter the pool once")
+	}
+	PutContext(c1)
+	PutContext(c2)
+}
+
+func TestSafeRedirect(t *testing.T) {
+	tests := []struct {
+		target   string
+		status   int
+		location string
+	}{
+		{"/dashboard?tab=1", http.StatusFound, "/dashboard?tab=1"},
+		{"https://accounts.example.com/welcome", http.StatusFound, "https://accounts.example.com/welcome"},
+		{"https://evil.example.net/phish", http.StatusBadRequest, ""},
+		{"//evil.example.net", http.StatusBadRequest, ""},
+		{"/\\evil.example.net", http.StatusBadRequest, ""},
+		{"javascript:alert(1)", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		ctx := &Context{}
+		req := httptest.NewRequest(http.MethodGet, "/login", nil)
+		w := httptest.NewRecorder()
+
+		ctx.SafeRedirect(w, req, http.StatusFound, tt.target, "accounts.example.com")
+
+		if w.Code != tt.status {
+			t.Errorf("SafeRedirect(%q): status = %d, want %d", tt.target, w.Code, tt.status)
+		}
+		if got := w.Header().Get("Location"); got != tt.location {
+			t.Errorf("SafeRedirect(%q): Location = %q, want %q", tt.target, got, tt.location)
+		}
+	}
+}
+
+func TestContextCancellationProxiesRequest(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	stdCtx, cancel := context.WithTimeout(context.Background(), time.Hour)
+
+	var deadlineOK bool
+	var errBefore, errAfter error
+	r.HandleFunc("/work", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, deadlineOK = ctx.Deadline()
+		errBefore = ctx.Err()
+		cancel()
+		<-ctx.Done()
+		errAfter = ctx.Err()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/work", nil).WithContext(stdCtx)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !deadlineOK {
+		t.Errorf("expected Deadline to report the request deadline")
+	}
+	if errBefore != nil {
+		t.Errorf("expected nil Err before cancel, got %v", errBefore)
+	}
+	if !errors.Is(errAfter, context.Canceled) {
+		t.Errorf("expected context.Canceled after cancel, got %v", errAfter)
+	}
+
+	empty := &Context{}
+	if _, ok := empty.Deadline(); ok || empty.Done() != nil || empty.Err() != nil {
+		t.Errorf("context without a request must report no deadline and no cancellation")
+	}
+}
+
+func TestContextRequest(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.Use(RequestID())
+
+	var seen *http.Request
+	r.HandleFunc("/who", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		if ctx.Req() != req {
+			t.Errorf("ctx.Req() must be the request passed to the handler")
+		}
+		seen = ctx.Req()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/who", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if seen == nil || GetRequestID(seen) == "" {
+		t.Fatalf("expected ctx.Req() to carry values added by middleware")
+	}
+
+	ctx := GetContext()
+	ctx.Request = req
+	PutContext(ctx)
+
+	if ctx = GetContext(); ctx.Request != nil {
+		t.Fatalf("pooled context leaked a request")
+	}
+}
+
+func TestParamsArePercentDecoded(t *testing.T) {
+	newRouter := func() *Router {
+		r := NewRouter().(*Router)
+		r.HandleFunc("/user/<name>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			name, _ := ctx.Param("name")
+			_, _ = w.Write([]byte("one:" + name))
+		})
+		r.HandleFunc("/user/<dir>/<name>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			dir, _ := ctx.Param("dir")
+			name, _ := ctx.Param("name")
+			_, _ = w.Write([]byte("two:" + dir + "|" + name))
+		})
+		return r
+	}
+
+	serve := func(r *Router, path string) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Body.String()
+	}
+
+	r := newRouter()
+	for path, want := range map[string]string{
+		"/user/John%20Doe":        "one:John Doe",
+		"/user/a%2Fb":             "one:a/b",
+		"/user/a%2fb%20c":         "one:a/b c",
+		"/user/a%2Fb%252Fc":       "one:a/b%2Fc",
+		"/user/100%25%2Fx":        "one:100%/x",
+		"/user/a%252Fb%2F%25":     "one:a%2Fb/%",
+		"/user/docs/a%2Fb":        "two:docs|a/b",
+		"/user/caf%C3%A9/r%C3%A9": "two:café|ré",
+	} {
+		if got := serve(r, path); got != want {
+			t.Errorf("%s: got %q, want %q", path, got, want)
+		}
+	}
+
+	raw := newRouter()
+	raw.RawPathParams(true)
+	for path, want := range map[string]string{
+		"/user/John%20Doe": "one:John%20Doe",
+		"/user/a%2Fb":      "one:a%2Fb",
+	} {
+		if got := serve(raw, path); got != want {
+			t.Errorf("raw %s: got %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestEncodedSlashFollowsPathRewrites(t *testing.T) {
+	param := func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		p, _ := ctx.Param("p")
+		_, _ = w.Write([]byte(p))
+	}
+
+	serve := func(h http.Handler, path string) (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	prefixed := NewRouter().(*Router)
+	prefixed.Prefix("/api")
+	prefixed.HandleFunc("/x/<p>", "GET", param)
+	for path, want := range map[string]string{"/api/x/a%2Fb": "a/b", "/api/x/a%20b": "a b"} {
+		if code, body := serve(prefixed.Handler(), path); code != http.StatusOK || body != want {
+			t.Errorf("prefix %s: got %d %q, want %q", path, code, body, want)
+		}
+	}
+
+	rewritten := NewRouter().(*Router)
+	rewritten.PreRoute(func(w http.ResponseWriter, req *http.Request) bool {
+		if rest, ok := strings.CutPrefix(req.URL.Path, "/old/"); ok {
+			req.URL.Path = "/new/" + rest
+		}
+		return true
+	})
+	rewritten.PreRoute(func(w http.ResponseWriter, req *http.Request) bool {
+		if rest, ok := strings.CutPrefix(req.URL.Path, "/keep/"); ok {
+			req.URL.Path = "/new/" + rest
+			req.URL.RawPath = "/new/" + strings.TrimPrefix(req.URL.RawPath, "/keep/")
+		}
+		return true
+	})
+	rewritten.HandleFunc("/new/<p>", "GET", param)
+	rewritten.HandleFunc("/new/<a>/<b>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte("split"))
+	})
+
+	for path, want := range map[string]string{"/old/a%2Fb": "split", "/keep/a%2Fb": "a/b"} {
+		if code, body := serve(rewritten, path); code != http.StatusOK || body != want {
+			t.Errorf("pre-route %s: got %d %q, want %q", path, code, body, want)
+		}
+	}
+}
+
+func TestContextRoute(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	var got []string
+	record := func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		got = append(got, ctx.Route())
+	}
+
+	r.HandleFunc("/users/<id:isDigits>", "GET", record)
+	r.HandleFunc("/about", "GET", record)
+	r.NotFound(record)
+
+	for _, path := range []string{"/users/42", "/about", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	want := []string{"/users/<id:isDigits>", "/about", ""}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d calls, got %v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d: Route() = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func BenchmarkContextPool(b *testing.B) {
+	b.Run("NoData", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ctx := GetContext()
+			ctx.Params = append(ctx.Params, Par{"id", "42"})
+			PutContext(ctx)
+		}
+	})
+
+	b.Run("WithData", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ctx := GetContext()
+			ctx.Set("request_id", "abc")
+			ctx.Set("user", i)
+			PutContext(ctx)
+		}
+	})
+}
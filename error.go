@@ -1,10 +1,13 @@
 package router
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"regexp"
@@ -41,12 +44,23 @@ func panicMessage() []string {
 	return panicError
 }
 
+func fullStack() []byte {
+	buf := make([]byte, 4096)
+	for {
+		n := runtime.Stack(buf, false)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
 func Error(w http.ResponseWriter, req *http.Request, message string, err error) bool {
 	if err == nil {
 		return false
 	}
 
-	logError(req, message, err, false)
+	logError(req, message, err, false, nil)
 
 	http.Error(w, message, http.StatusInternalServerError)
 
@@ -60,6 +74,19 @@ func JSONError(w http.ResponseWriter, req *http.Request, message string, err err
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":      true,
+			"message":    message,
+			"statusCode": http.StatusBadRequest,
+			"fields":     ve.Fields,
+		})
+		return true
+	}
+
 	w.WriteHeader(http.StatusInternalServerError)
 
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
@@ -71,7 +98,54 @@ func JSONError(w http.ResponseWriter, req *http.Request, message string, err err
 	return true
 }
 
-func logError(req *http.Request, message any, err error, terminal bool) {
+func logError(req *http.Request, message any, err error, terminal bool, logger Logger) {
+	writeErrorLog(req, message, strings.Join(panicMessage(), "\n"), terminal, logger)
+}
+
+func (r *Router) logPanic(req *http.Request, ctx *Context, message any) {
+	var errors string
+	if r.verboseStacks {
+		errors = string(fullStack()) + "\n"
+	} else {
+		errors = strings.Join(panicMessage(), "\n")
+	}
+
+	if r.errorLogger == nil {
+		writeErrorLog(req, message, errors, r.terminalOutput, r.customLogger())
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, 5)
+	if req != nil {
+		attrs = append(attrs, slog.String("url", req.URL.String()), slog.String("method", req.Method))
+	}
+	if ctx != nil {
+		if id := ctx.RequestID(); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+	}
+	attrs = append(attrs, slog.Any("error", message), slog.String("stack", strings.TrimSpace(errors)))
+
+	logCtx := context.Background()
+	if req != nil {
+		logCtx = req.Context()
+	}
+	r.errorLogger.LogAttrs(logCtx, slog.LevelError, "panic occurred", attrs...)
+}
+
+func (r *Router) VerboseStackTraces(verbose bool) {
+	r.mustNotBeSealed("VerboseStackTraces")
+
+	r.verboseStacks = verbose
+}
+
+func (r *Router) SetErrorLogger(l *slog.Logger) {
+	r.mustNotBeSealed("SetErrorLogger")
+
+	r.errorLogger = l
+}
+
+func writeErrorLog(req *http.Request, message any, errors string, terminal bool, logger Logger) {
 	logFile := openFile("logs", (time.Now().Format("2006-01-02"))+".error.log")
 	var w io.Writer = os.Stderr
 	if logFile != nil {
@@ -79,8 +153,6 @@ func logError(req *http.Request, message any, err error, terminal bool) {
 		defer closeFile(logFile)
 	}
 
-	errors := strings.Join(panicMessage(), "\n")
-
 	var path, method string
 	if req != nil {
 		path = req.URL.Path
@@ -93,14 +165,28 @@ func logError(req *http.Request, message any, err error, terminal bool) {
 	l := log.New(w, "", log.LstdFlags)
 	l.Printf("Panic occurred on URL %s | method [%s]\nError message: %s\n%s%s\n\n",
 		path, method, message, errors, strings.Repeat("_", 95))
+	if logger != nil {
+		logger.Error("panic occurred", "path", path, "method", method, "error", message, "stack", strings.TrimSpace(errors))
+		return
+	}
 	if terminal {
 		terminalOutput(path, method, message, errors)
 	}
 }
 
-func logRequest(req *http.Request, start time.Time) {
+func (r *Router) logRequest(req *http.Request, start time.Time) {
 	duration := time.Since(start)
 
+	if l := r.customLogger(); l != nil {
+		l.Info("request", "method", req.Method, "host", req.Host, "path", req.URL.Path, "duration", duration, "ip", r.clientIP(req))
+		return
+	}
+
+	fmt.Println(requestLogLine(req, r.clientIP(req), duration))
+}
+
+func requestLogLine(req *http.Request, ip string, duration time.Duration) string {
+
 	var d string
 	switch {
 	case duration >= time.Millisecond:
@@ -118,5 +204,5 @@ func logRequest(req *http.Request, start time.Time) {
 		text:       fmt.Sprintf(" Method[%s] ", req.Method),
 	})
 	url := req.Host + req.URL.Path
-	fmt.Printf("%s: %s %s in %s\n", timestamp, method, url, d)
+	return fmt.Sprintf("%s: %s %s in %s from %s", timestamp, method, url, d, ip)
 }
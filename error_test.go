@@ -1,7 +1,12 @@
 package router
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -21,7 +26,7 @@ func TestError_WritesToLogFile(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/", nil)
 	req.Host = "localhost"
 
-	logError(req, "simulated panic", nil, false)
+	logError(req, "simulated panic", nil, false, nil)
 
 	filename := time.Now().Format("2006-01-02") + ".error.log"
 	path := filepath.Join("logs", filename)
@@ -47,3 +52,120 @@ func TestError_WritesToLogFile(t *testing.T) {
 		t.Errorf("log content missing expected text:\n%s", string(data))
 	}
 }
+
+func TestJSONErrorWritesHeadersOnce(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	rec := &headerCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	if !JSONError(rec, req, "failed", errors.New("boom")) {
+		t.Fatal("expected JSONError to report the error as handled")
+	}
+
+	if rec.writeHeaderCalls != 1 {
+		t.Errorf("WriteHeader called %d times, want 1", rec.writeHeaderCalls)
+	}
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if ct := rec.Header().Values("Content-Type"); len(ct) != 1 || ct[0] != "application/json" {
+		t.Errorf("Content-Type = %q, want a single application/json", ct)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if body["message"] != "failed" || body["error"] != true {
+		t.Errorf("unexpected body %v", body)
+	}
+
+	plain := httptest.NewRecorder()
+	if JSONError(plain, req, "failed", nil) {
+		t.Error("expected JSONError to ignore a nil error")
+	}
+	if plain.Body.Len() != 0 {
+		t.Errorf("expected no body for a nil error, got %q", plain.Body.String())
+	}
+}
+
+func TestSetErrorLoggerEmitsStructuredPanic(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := NewRouter().(*Router)
+	r.SetErrorLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	r.Use(RequestID())
+
+	r.HandleFunc("/boom", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		panic("kaboom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/boom?x=1", nil)
+	req.Header.Set("X-Request-ID", "req-7")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+
+	want := map[string]string{
+		"level":      "ERROR",
+		"msg":        "panic occurred",
+		"url":        "/boom?x=1",
+		"method":     "GET",
+		"request_id": "req-7",
+		"error":      "kaboom",
+	}
+	for k, v := range want {
+		if record[k] != v {
+			t.Errorf("record[%q] = %v, want %q", k, record[k], v)
+		}
+	}
+
+	if stack, _ := record["stack"].(string); !strings.Contains(stack, "error_test.go") {
+		t.Errorf("expected stack to point at the panicking handler, got %q", stack)
+	}
+}
+
+func panicDeep(depth int) {
+	if depth == 0 {
+		panic("deep")
+	}
+	panicDeep(depth - 1)
+}
+
+func TestVerboseStackTracesCaptureFullStack(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := NewRouter().(*Router)
+	r.SetErrorLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	r.VerboseStackTraces(true)
+
+	r.HandleFunc("/deep", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		panicDeep(60)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/deep", nil))
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a JSON record, got %q: %v", buf.String(), err)
+	}
+
+	stack, _ := record["stack"].(string)
+	if len(stack) <= 4096 {
+		t.Fatalf("expected stack beyond the 4096 byte summary buffer, got %d bytes", len(stack))
+	}
+	if !strings.HasPrefix(stack, "goroutine ") {
+		t.Errorf("expected a full goroutine dump, got %q", stack[:40])
+	}
+	if n := strings.Count(stack, "panicDeep"); n < 60 {
+		t.Errorf("expected every recursive frame in the stack, found %d", n)
+	}
+}
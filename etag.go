@@ -0,0 +1,146 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var MaxETagBytes int64 = 1 << 20
+
+type etagWriter struct {
+	http.ResponseWriter
+	buf         bytes.Buffer
+	status      int
+	limit       int64
+	passthrough bool
+	wroteHeader bool
+}
+
+func (ew *etagWriter) WriteHeader(status int) {
+	if ew.wroteHeader {
+		return
+	}
+	ew.wroteHeader = true
+	ew.status = status
+
+	if status != http.StatusOK {
+		ew.release()
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.passthrough {
+		return ew.ResponseWriter.Write(b)
+	}
+
+	if ew.limit > 0 && int64(ew.buf.Len()+len(b)) > ew.limit {
+		ew.release()
+		return ew.ResponseWriter.Write(b)
+	}
+	return ew.buf.Write(b)
+}
+
+func (ew *etagWriter) Flush() {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	ew.release()
+	if fl, ok := ew.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+func (ew *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := ew.ResponseWriter.(http.Hijacker); ok {
+		ew.passthrough = true
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("hijacker not supported")
+}
+
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+func (ew *etagWriter) release() {
+	if ew.passthrough {
+		return
+	}
+	ew.passthrough = true
+
+	ew.ResponseWriter.WriteHeader(ew.status)
+	if ew.buf.Len() > 0 {
+		_, _ = ew.ResponseWriter.Write(ew.buf.Bytes())
+	}
+	ew.buf = bytes.Buffer{}
+}
+
+func (ew *etagWriter) finish(r *http.Request) {
+	if ew.passthrough {
+		return
+	}
+	if !ew.wroteHeader {
+		ew.status = http.StatusOK
+	}
+
+	h := ew.Header()
+	etag := h.Get("ETag")
+	if etag == "" {
+		sum := fnv.New64a()
+		_, _ = sum.Write(ew.buf.Bytes())
+		etag = `W/"` + strconv.FormatUint(sum.Sum64(), 16) + `"`
+		h.Set("ETag", etag)
+	}
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		h.Del("Content-Length")
+		h.Del("Content-Type")
+		ew.passthrough = true
+		ew.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if h.Get("Content-Length") == "" && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Length", strconv.Itoa(ew.buf.Len()))
+	}
+	ew.release()
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+func ETag() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, c *Context) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next(w, r, c)
+				return
+			}
+
+			ew := &etagWriter{ResponseWriter: w, limit: MaxETagBytes}
+			next(ew, r, c)
+			ew.finish(r)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestETagConditionalGet(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.Use(ETag())
+	r.HandleFunc("/status", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		JSON(w, http.StatusOK, map[string]string{"state": "idle"})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) || !strings.Contains(w.Body.String(), "idle") {
+		t.Fatalf("expected a 200 with an ETag, got %d %q %q", w.Code, etag, w.Body.String())
+	}
+
+	for _, inm := range []string{etag, strings.TrimPrefix(etag, "W/"), `"other", ` + etag, "*"} {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		req.Header.Set("If-None-Match", inm)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+			t.Fatalf("If-None-Match %q: expected an empty 304, got %d %q", inm, w.Code, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("If-None-Match", `"stale"`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Fatalf("expected a full response for a stale ETag, got %d", w.Code)
+	}
+}
+
+func TestETagSkipsLargeStreamedAndErrorResponses(t *testing.T) {
+	old := MaxETagBytes
+	MaxETagBytes = 16
+	defer func() { MaxETagBytes = old }()
+
+	r := NewRouter().(*Router)
+	r.Use(ETag())
+	r.HandleFunc("/large", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte("0123456789"))
+		_, _ = w.Write([]byte("0123456789"))
+	})
+	r.HandleFunc("/stream", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte("tick"))
+		w.(http.Flusher).Flush()
+	})
+	r.HandleFunc("/missing", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		http.Error(w, "gone", http.StatusNotFound)
+	})
+	r.HandleFunc("/tagged", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		w.Header().Set("ETag", `"v2"`)
+		_, _ = w.Write([]byte("v2"))
+	})
+
+	cases := []struct {
+		path   string
+		status int
+		body   string
+		etag   string
+	}{
+		{"/large", http.StatusOK, "01234567890123456789", ""},
+		{"/stream", http.StatusOK, "tick", ""},
+		{"/missing", http.StatusNotFound, "gone\n", ""},
+		{"/tagged", http.StatusOK, "v2", `"v2"`},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+		if w.Code != tc.status || w.Body.String() != tc.body || w.Header().Get("ETag") != tc.etag {
+			t.Errorf("%s: got %d %q etag=%q", tc.path, w.Code, w.Body.String(), w.Header().Get("ETag"))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/tagged", nil)
+	req.Header.Set("If-None-Match", `"v2"`)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected the handler's own ETag to be honoured, got %d", w.Code)
+	}
+}
@@ -2,4 +2,4 @@ module github.com/NetLifeGuru/router
 
 go 1.24.1
 
-require golang.org/x/sys v0.36.0 // indirect
+require golang.org/x/sys v0.36.0
@@ -1,12 +1,23 @@
 package router
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"html/template"
+	"io"
+	"iter"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"reflect"
+	"regexp/syntax"
+	"strconv"
 	"strings"
 )
 
@@ -27,6 +38,8 @@ type Msg struct {
 
 const routeParamsKey contextKey = "routeParams"
 
+var MaxBodyBytes int64 = 1 << 20
+
 func JSONResponse(w http.ResponseWriter, status int, payload any, errMsg any) {
 	response := ApiResponse{
 		Success: errMsg == nil,
@@ -39,25 +52,12 @@ func JSONResponse(w http.ResponseWriter, status int, payload any, errMsg any) {
 		response.Data = payload
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-
-	jsonData, err := json.Marshal(response)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	_, err = w.Write(jsonData)
-	if err != nil {
-		fmt.Println(err)
-	}
+	writeJSON(w, status, response)
 }
 
 func JSON(w http.ResponseWriter, status int, data any) {
-	w.Header().Set("Content-Type", "application/json")
-
 	if data == nil {
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(status)
 		_, _ = w.Write([]byte(`{}`))
 		return
@@ -67,14 +67,23 @@ func JSON(w http.ResponseWriter, status int, data any) {
 		status = msg.StatusCode
 	}
 
+	writeJSON(w, status, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		pkgLog().Error("Failed to encode JSON response", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	_, _ = w.Write(jsonData)
+
+	if _, err = w.Write(jsonData); err != nil {
+		pkgLog().Error("Failed to write JSON response", "error", err)
+	}
 }
 
 func ensureDirectory(path string) error {
@@ -149,13 +158,17 @@ func BuildCacheKey(method, path string) string {
 	return b.String()
 }
 
-func countCaptureGroups(s string) int {
-	left := strings.Count(s, "(")
-	right := strings.Count(s, ")")
-	if left != right {
-		return -1
+// countCaptureGroups reports how many capturing groups a route pattern has,
+// which decides whether its submatches are exposed as parameters. Named
+// (?P<x>...) / (?<x>...) and unnamed (...) groups count; non-capturing (?:...)
+// groups, flag groups and escaped parentheses do not. Lookarounds and
+// backreferences are not valid RE2 and return an error.
+func countCaptureGroups(s string) (int, error) {
+	re, err := syntax.Parse(s, syntax.Perl)
+	if err != nil {
+		return 0, err
 	}
-	return left
+	return re.MaxCap(), nil
 }
 
 func Text(w http.ResponseWriter, status int, message string) {
@@ -167,6 +180,141 @@ func Text(w http.ResponseWriter, status int, message string) {
 	}
 }
 
+// jsonStreamFlushEvery is how many array elements JSONStream writes between
+// flushes.
+const jsonStreamFlushEvery = 64
+
+// JSONStream writes v as JSON. Slices and arrays are encoded element by
+// element and flushed as they go, so only one element is held in memory at a
+// time; any other value is encoded in one piece.
+func JSONStream(w http.ResponseWriter, status int, v any) error {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() || rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		fallthrough
+	case reflect.Array:
+		return JSONStreamSeq(w, status, func(yield func(any) bool) {
+			for i := 0; i < rv.Len(); i++ {
+				if !yield(rv.Index(i).Interface()) {
+					return
+				}
+			}
+		})
+	}
+
+	writeStreamHeader(w, status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		pkgLog().Error("Failed to stream JSON response", "error", err)
+		return err
+	}
+	return nil
+}
+
+// JSONStreamSeq writes the values produced by seq as a JSON array, encoding
+// and flushing them as they arrive, e.g. from a database cursor.
+func JSONStreamSeq[T any](w http.ResponseWriter, status int, seq iter.Seq[T]) error {
+	writeStreamHeader(w, status)
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	n := 0
+	for item := range seq {
+		if n > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(item); err != nil {
+			pkgLog().Error("Failed to stream JSON response", "error", err)
+			return err
+		}
+
+		n++
+		if n%jsonStreamFlushEvery == 0 {
+			_ = rc.Flush()
+		}
+	}
+
+	if _, err := io.WriteString(w, "]\n"); err != nil {
+		return err
+	}
+	_ = rc.Flush()
+	return nil
+}
+
+func writeStreamHeader(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+}
+
+func XML(w http.ResponseWriter, status int, data any) {
+	xmlData, err := xml.Marshal(data)
+	if err != nil {
+		pkgLog().Error("Failed to encode XML response", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(xmlData)
+}
+
+func BindJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(limitBody(r)).Decode(v); err != nil {
+		return err
+	}
+	return ValidateStruct(v)
+}
+
+func BindXML(r *http.Request, v any) error {
+	if err := xml.NewDecoder(limitBody(r)).Decode(v); err != nil {
+		return err
+	}
+	return ValidateStruct(v)
+}
+
+func limitBody(r *http.Request) io.Reader {
+	if MaxBodyBytes <= 0 {
+		return r.Body
+	}
+	r.Body = http.MaxBytesReader(nil, r.Body, MaxBodyBytes)
+	return r.Body
+}
+
+func HTML(w http.ResponseWriter, status int, tmpl *template.Template, name string, data any) {
+	var buf bytes.Buffer
+
+	var err error
+	if name == "" {
+		err = tmpl.Execute(&buf, data)
+	} else {
+		err = tmpl.ExecuteTemplate(&buf, name, data)
+	}
+
+	if err != nil {
+		pkgLog().Error("Failed to render HTML template", "template", name, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
 func Param(req *http.Request, key string) string {
 	params, ok := req.Context().Value(routeParamsKey).(map[string]interface{})
 
@@ -195,3 +343,61 @@ func Post(r *http.Request) (url.Values, error) {
 func Query(r *http.Request, key string) string {
 	return r.URL.Query().Get(key)
 }
+
+func Cookie(r *http.Request, name string) string {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+func SetCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	http.SetCookie(w, cookie)
+}
+
+func SetSignedCookie(w http.ResponseWriter, cookie *http.Cookie, key []byte) {
+	signed := *cookie
+	signed.Value = signCookieValue(cookie.Name, cookie.Value, key)
+	http.SetCookie(w, &signed)
+}
+
+func SignedCookie(r *http.Request, name string, key []byte) (string, bool) {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	return verifyCookieValue(name, c.Value, key)
+}
+
+func signCookieValue(name, value string, key []byte) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(cookieMAC(name, encoded, key))
+}
+
+func verifyCookieValue(name, signed string, key []byte) (string, bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", false
+	}
+
+	encoded, sig := signed[:i], signed[i+1:]
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, cookieMAC(name, encoded, key)) {
+		return "", false
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(value), true
+}
+
+func cookieMAC(name, encoded string, key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(name))
+	h.Write([]byte{'='})
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
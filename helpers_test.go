@@ -2,6 +2,9 @@ package router
 
 import (
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html/template"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -116,3 +119,326 @@ func TestCloseFile(t *testing.T) {
 
 	closeFile(tmpFile)
 }
+
+func TestCookieHelpers(t *testing.T) {
+	rec := httptest.NewRecorder()
+	SetCookie(rec, &http.Cookie{Name: "theme", Value: "dark", Path: "/"})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	if got := Cookie(req, "theme"); got != "dark" {
+		t.Errorf("Cookie(theme) = %q, want %q", got, "dark")
+	}
+	if got := Cookie(req, "missing"); got != "" {
+		t.Errorf("Cookie(missing) = %q, want empty", got)
+	}
+}
+
+func TestSignedCookie(t *testing.T) {
+	key := []byte("secret-key")
+
+	rec := httptest.NewRecorder()
+	SetSignedCookie(rec, &http.Cookie{Name: "sid", Value: "user:42; admin=false", HttpOnly: true}, key)
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("expected one HttpOnly cookie, got %+v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+
+	if v, ok := SignedCookie(req, "sid", key); !ok || v != "user:42; admin=false" {
+		t.Errorf("SignedCookie = %q (ok=%v), want original value", v, ok)
+	}
+	if _, ok := SignedCookie(req, "sid", []byte("other-key")); ok {
+		t.Errorf("expected verification with a different key to fail")
+	}
+
+	tampered := httptest.NewRequest(http.MethodGet, "/", nil)
+	tampered.AddCookie(&http.Cookie{Name: "sid", Value: "x" + cookies[0].Value})
+	if _, ok := SignedCookie(tampered, "sid", key); ok {
+		t.Errorf("expected tampered cookie to fail verification")
+	}
+
+	renamed := httptest.NewRequest(http.MethodGet, "/", nil)
+	renamed.AddCookie(&http.Cookie{Name: "other", Value: cookies[0].Value})
+	if _, ok := SignedCookie(renamed, "other", key); ok {
+		t.Errorf("expected signature to be bound to the cookie name")
+	}
+}
+
+func TestHTML(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`<h1>{{.Title}}</h1>{{define "broken"}}<p>{{.Missing.Field}}</p>{{end}}`))
+
+	rec := httptest.NewRecorder()
+	HTML(rec, http.StatusOK, tmpl, "page", map[string]string{"Title": "<Hi>"})
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Body.String(); got != "<h1>&lt;Hi&gt;</h1>" {
+		t.Errorf("unexpected body: %q", got)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("unexpected Content-Type: %q", ct)
+	}
+
+	rec = httptest.NewRecorder()
+	HTML(rec, http.StatusOK, tmpl, "broken", struct{ Missing *struct{ Field string } }{})
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if strings.Contains(rec.Body.String(), "<p>") {
+		t.Errorf("partial template output leaked into the response: %q", rec.Body.String())
+	}
+}
+
+type xmlOrder struct {
+	XMLName xml.Name `xml:"order"`
+	ID      int      `xml:"id,attr"`
+	Item    string   `xml:"item"`
+}
+
+func TestXML(t *testing.T) {
+	rec := httptest.NewRecorder()
+	XML(rec, http.StatusCreated, xmlOrder{ID: 7, Item: "book"})
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/xml; charset=utf-8" {
+		t.Errorf("unexpected Content-Type: %q", ct)
+	}
+	if want := xml.Header + `<order id="7"><item>book</item></order>`; rec.Body.String() != want {
+		t.Errorf("body = %q, want %q", rec.Body.String(), want)
+	}
+}
+
+func TestXMLMarshalFailureHidesError(t *testing.T) {
+	logger := &recordingLogger{}
+	SetLogger(logger)
+	defer SetLogger(nil)
+
+	rec := httptest.NewRecorder()
+	XML(rec, http.StatusOK, map[string]string{"secret": "value"})
+
+	if rec.Code != http.StatusInternalServerError || strings.TrimSpace(rec.Body.String()) != http.StatusText(http.StatusInternalServerError) {
+		t.Fatalf("expected a generic 500, got %d %q", rec.Code, rec.Body.String())
+	}
+	if len(logger.entries) != 1 || !strings.Contains(logger.entries[0], "unsupported type") {
+		t.Fatalf("expected the marshal error to be logged, got %v", logger.entries)
+	}
+}
+
+func TestBindXMLAndJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`<order id="3"><item>pen</item></order>`))
+	var o xmlOrder
+	if err := BindXML(req, &o); err != nil || o.ID != 3 || o.Item != "pen" {
+		t.Errorf("BindXML = %+v, %v", o, err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"alice"}`))
+	var u struct{ Name string }
+	if err := BindJSON(req, &u); err != nil || u.Name != "alice" {
+		t.Errorf("BindJSON = %+v, %v", u, err)
+	}
+}
+
+func TestBindRespectsMaxBodyBytes(t *testing.T) {
+	old := MaxBodyBytes
+	MaxBodyBytes = 16
+	defer func() { MaxBodyBytes = old }()
+
+	var maxErr *http.MaxBytesError
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`<order><item>`+strings.Repeat("x", 64)+`</item></order>`))
+	var o xmlOrder
+	if err := BindXML(req, &o); !errors.As(err, &maxErr) {
+		t.Errorf("BindXML: expected MaxBytesError, got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"`+strings.Repeat("x", 64)+`"}`))
+	var u struct{ Name string }
+	if err := BindJSON(req, &u); !errors.As(err, &maxErr) {
+		t.Errorf("BindJSON: expected MaxBytesError, got %v", err)
+	}
+}
+
+func TestJSONStream(t *testing.T) {
+	rows := make([]map[string]int, 1000)
+	for i := range rows {
+		rows[i] = map[string]int{"id": i}
+	}
+
+	rec := httptest.NewRecorder()
+	if err := JSONStream(rec, http.StatusOK, rows); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []map[string]int
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != 1000 || got[999]["id"] != 999 {
+		t.Fatalf("unexpected streamed body (err=%v, len=%d)", err, len(got))
+	}
+
+	rec = httptest.NewRecorder()
+	var flushedEarly bool
+	err := JSONStreamSeq(rec, http.StatusOK, func(yield func(int) bool) {
+		for i := 0; i < 200; i++ {
+			if i == 100 {
+				flushedEarly = rec.Flushed && strings.HasPrefix(rec.Body.String(), "[0\n,1\n")
+			}
+			if !yield(i) {
+				return
+			}
+		}
+	})
+	var ints []int
+	if err != nil || json.Unmarshal(rec.Body.Bytes(), &ints) != nil || len(ints) != 200 || ints[199] != 199 {
+		t.Fatalf("unexpected sequence body (err=%v): %q", err, rec.Body.String())
+	}
+	if !flushedEarly {
+		t.Fatalf("expected elements to be written and flushed before the sequence ended")
+	}
+
+	rec = httptest.NewRecorder()
+	if err := JSONStreamSeq(rec, http.StatusOK, func(yield func(int) bool) {}); err != nil || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Fatalf("expected an empty array, got %q (%v)", rec.Body.String(), err)
+	}
+
+	rec = httptest.NewRecorder()
+	err = JSONStream(rec, http.StatusOK, map[string]any{"bad": make(chan int)})
+	if err == nil {
+		t.Fatalf("expected encoding error")
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status must stay committed after streaming starts, got %d", rec.Code)
+	}
+}
+
+type headerCountingRecorder struct {
+	*httptest.ResponseRecorder
+	writeHeaderCalls int
+}
+
+func (r *headerCountingRecorder) WriteHeader(status int) {
+	r.writeHeaderCalls++
+	r.ResponseRecorder.WriteHeader(status)
+}
+
+func TestJSONEncodingFailureIsCleanServerError(t *testing.T) {
+	bad := map[string]any{"ch": make(chan int)}
+
+	for name, write := range map[string]func(http.ResponseWriter){
+		"JSON":         func(w http.ResponseWriter) { JSON(w, http.StatusOK, bad) },
+		"JSONResponse": func(w http.ResponseWriter) { JSONResponse(w, http.StatusOK, bad, nil) },
+	} {
+		rec := &headerCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+		write(rec)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("%s: status = %d, want %d", name, rec.Code, http.StatusInternalServerError)
+		}
+		if rec.writeHeaderCalls != 1 {
+			t.Errorf("%s: WriteHeader called %d times, want 1", name, rec.writeHeaderCalls)
+		}
+		if ct := rec.Header().Get("Content-Type"); strings.HasPrefix(ct, "application/json") {
+			t.Errorf("%s: error response must not claim JSON content, got %q", name, ct)
+		}
+		if strings.Contains(rec.Body.String(), "{") {
+			t.Errorf("%s: partial JSON leaked into body: %q", name, rec.Body.String())
+		}
+	}
+}
+
+func TestCountCaptureGroupsClassifiesRoutes(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	cases := []struct {
+		pattern string
+		groups  int
+		kind    int
+	}{
+		{`(?:abc|def)`, 0, _MATCH},
+		{`v(?:\d+)\.(?:\d+)`, 0, _MATCH},
+		{`red|green|blue`, 0, _MATCH},
+		{`(red|green)-(\d+)`, 2, _SUBMATCH},
+		{`(?:x)(\d+)`, 1, _SUBMATCH},
+		{`\(\d+\)`, 0, _MATCH},
+		{`[()]+`, 0, _MATCH},
+	}
+
+	for _, tc := range cases {
+		if got, err := countCaptureGroups(tc.pattern); err != nil || got != tc.groups {
+			t.Errorf("countCaptureGroups(%q) = %d, %v, want %d", tc.pattern, got, err, tc.groups)
+		}
+
+		patterns, _, _, _, err := r.preparePattern("/p/<v:" + tc.pattern + ">")
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.pattern, err)
+			continue
+		}
+		if got := patterns[1].Type; got != tc.kind {
+			t.Errorf("%q: classified as %d, want %d", tc.pattern, got, tc.kind)
+		}
+	}
+
+	r.HandleFunc("/colors/<c:red|green|blue>", "GET", handlerWithID("color"))
+	r.HandleFunc("/sizes/<s:(s|m)-(\\d+)|xl>", "GET", handlerWithID("size"))
+	for path, match := range map[string]bool{
+		"/colors/green":   true,
+		"/colors/xgreenx": false,
+		"/colors/redish":  false,
+		"/sizes/m-2":      true,
+		"/sizes/xl":       true,
+		"/sizes/m-2xl":    false,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if (w.Code == http.StatusOK) != match {
+			t.Errorf("%s: expected match=%v, got %d", path, match, w.Code)
+		}
+	}
+
+	if _, err := countCaptureGroups(`(a)\1`); err == nil {
+		t.Error("expected a backreference to be rejected")
+	}
+	if _, _, _, _, err := r.preparePattern(`/p/<v:(a)\1>`); err == nil {
+		t.Error("expected a route with a backreference to fail")
+	}
+}
+
+func TestCountCaptureGroupsNamedAndLookaround(t *testing.T) {
+	for pattern, want := range map[string]int{
+		`(?P<major>\d+)\.(?P<minor>\d+)`: 2,
+		`(?<major>\d+)\.(\d+)`:           2,
+		`(?i)(?:v)(?P<n>\d+)`:            1,
+		`(?i:abc)`:                       0,
+	} {
+		if got, err := countCaptureGroups(pattern); err != nil || got != want {
+			t.Errorf("countCaptureGroups(%q) = %d, %v, want %d", pattern, got, err, want)
+		}
+	}
+
+	for _, pattern := range []string{`a(?=b)`, `(?!a)b`, `(?<=a)b`, `(?<!a)b`} {
+		if _, err := countCaptureGroups(pattern); err == nil {
+			t.Errorf("expected lookaround %q to be rejected", pattern)
+		}
+	}
+
+	r := NewRouter().(*Router)
+	var params map[string]string
+	r.HandleFunc(`/v/<ver:(?<major>\d+)\.(?:x-)?(\d+)>`, "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		params = ctx.ParamMap()
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v/3.x-14", nil))
+
+	if params["ver"] != "3.x-14" || params["major"] != "3" || params["ver.2"] != "14" || len(params) != 3 {
+		t.Fatalf("unexpected submatch params: %v", params)
+	}
+}
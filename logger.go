@@ -0,0 +1,148 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+	With(args ...any) Logger
+}
+
+type terminalLogger struct {
+	out    io.Writer
+	fields []any
+}
+
+var defaultLogger Logger = &terminalLogger{out: os.Stdout}
+
+func (l *terminalLogger) Debug(msg string, args ...any) {
+	l.log("DEBUG", msg, args)
+}
+
+func (l *terminalLogger) Info(msg string, args ...any) {
+	l.log("INFO", msg, args)
+}
+
+func (l *terminalLogger) Warn(msg string, args ...any) {
+	l.log("WARN", msg, args)
+}
+
+func (l *terminalLogger) Error(msg string, args ...any) {
+	l.log("ERROR", msg, args)
+}
+
+func (l *terminalLogger) With(args ...any) Logger {
+	fields := make([]any, 0, len(l.fields)+len(args))
+	fields = append(fields, l.fields...)
+	fields = append(fields, args...)
+
+	return &terminalLogger{out: l.out, fields: fields}
+}
+
+func (l *terminalLogger) log(level string, msg string, args []any) {
+	out := l.out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	logTo(out, level, "%s", formatFields(msg, l.fields, args))
+}
+
+func formatFields(msg string, groups ...[]any) string {
+	var b strings.Builder
+	b.WriteString(msg)
+
+	for _, fields := range groups {
+		for i := 0; i < len(fields); i += 2 {
+			b.WriteByte(' ')
+			if i+1 < len(fields) {
+				fmt.Fprintf(&b, "%v=%v", fields[i], fields[i+1])
+			} else {
+				fmt.Fprintf(&b, "!BADKEY=%v", fields[i])
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func (r *Router) log() Logger {
+	if r.logger == nil {
+		return defaultLogger
+	}
+	return r.logger
+}
+
+func (r *Router) customLogger() Logger {
+	if r.logger == nil || r.logger == defaultLogger {
+		return nil
+	}
+	return r.logger
+}
+
+// logsEnabled reports whether lifecycle messages should be emitted: always
+// with a custom logger, and with the default one only under TerminalOutput.
+func (r *Router) logsEnabled() bool {
+	return r.terminalOutput || r.customLogger() != nil
+}
+
+func (r *Router) SetLogger(l Logger) {
+	r.mustNotBeSealed("SetLogger")
+
+	if l == nil {
+		l = defaultLogger
+	}
+	r.logger = l
+}
+
+var (
+	packageLoggerMu sync.RWMutex
+	packageLogger   = defaultLogger
+)
+
+// SetLogger sets the logger used where no router is in reach: the response
+// helpers (JSON, JSONStream, XML, HTML) and middleware constructors such as
+// CORS. Routers keep using the logger passed to (*Router).SetLogger.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = defaultLogger
+	}
+
+	packageLoggerMu.Lock()
+	packageLogger = l
+	packageLoggerMu.Unlock()
+}
+
+func pkgLog() Logger {
+	packageLoggerMu.RLock()
+	defer packageLoggerMu.RUnlock()
+	return packageLogger
+}
+
+func (c *Context) Logger() Logger {
+	l := defaultLogger
+	if c.router != nil && c.router.logger != nil {
+		l = c.router.logger
+	}
+
+	fields := make([]any, 0, 8)
+	if id := c.RequestID(); id != "" {
+		fields = append(fields, "request_id", id)
+	}
+	if ip := c.RealIP(); ip != "" {
+		fields = append(fields, "real_ip", ip)
+	}
+	if c.Request != nil {
+		fields = append(fields, "method", c.Request.Method, "path", c.Request.URL.Path)
+	}
+
+	return l.With(fields...)
+}
@@ -0,0 +1,134 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFormatFields(t *testing.T) {
+	got := formatFields("hello", []any{"a", 1}, []any{"b", "x", "dangling"})
+	want := "hello a=1 b=x !BADKEY=dangling"
+	if got != want {
+		t.Fatalf("formatFields = %q, want %q", got, want)
+	}
+}
+
+func TestContextLoggerIncludesRequestFields(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := NewRouter().(*Router)
+	r.SetLogger(&terminalLogger{out: &buf})
+	r.Use(RequestID())
+
+	r.HandleFunc("/orders/<id:isDigits>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		ctx.Logger().Info("order loaded")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/7", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	line := buf.String()
+	for _, want := range []string{"order loaded", "request_id=req-42", "method=GET", "path=/orders/7", "[INFO]"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log line %q does not contain %q", line, want)
+		}
+	}
+}
+
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) record(level, msg string, args []any) {
+	l.mu.Lock()
+	l.entries = append(l.entries, level+" "+formatFields(msg, args))
+	l.mu.Unlock()
+}
+
+func (l *recordingLogger) Debug(msg string, args ...any) { l.record("DEBUG", msg, args) }
+func (l *recordingLogger) Info(msg string, args ...any)  { l.record("INFO", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...any)  { l.record("WARN", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...any) { l.record("ERROR", msg, args) }
+func (l *recordingLogger) With(args ...any) Logger       { return l }
+
+func TestRouterLogsThroughCustomLogger(t *testing.T) {
+	defer os.RemoveAll("./logs")
+
+	logger := &recordingLogger{}
+
+	r := NewRouter().(*Router)
+	r.SetLogger(logger)
+	r.TerminalOutput(true)
+
+	r.HandleFunc("/ok", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r.HandleFunc("/boom", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		panic("kaboom")
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	logger.mu.Lock()
+	all := strings.Join(logger.entries, "\n")
+	logger.mu.Unlock()
+
+	for _, want := range []string{
+		"INFO request method=GET",
+		"path=/ok",
+		"ERROR panic occurred path=/boom method=GET error=kaboom",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("logged entries %q do not contain %q", all, want)
+		}
+	}
+}
+
+type brokenResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (brokenResponseWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestPackageLoggerReceivesHelperMessages(t *testing.T) {
+	logger := &recordingLogger{}
+	SetLogger(logger)
+	defer SetLogger(nil)
+
+	JSON(httptest.NewRecorder(), http.StatusOK, make(chan int))
+	JSON(brokenResponseWriter{httptest.NewRecorder()}, http.StatusOK, "ok")
+	_ = JSONStream(httptest.NewRecorder(), http.StatusOK, make(chan int))
+	HTML(httptest.NewRecorder(), http.StatusOK, template.Must(template.New("page").Parse("ok")), "missing", nil)
+	CORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+
+	want := []string{
+		"ERROR Failed to encode JSON response",
+		"ERROR Failed to write JSON response error=connection reset",
+		"ERROR Failed to stream JSON response",
+		"ERROR Failed to render HTML template template=missing",
+		"WARN CORS: AllowCredentials",
+	}
+	if len(logger.entries) != len(want) {
+		t.Fatalf("expected %d entries, got %v", len(want), logger.entries)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(logger.entries[i], prefix) {
+			t.Errorf("entry %d = %q, want prefix %q", i, logger.entries[i], prefix)
+		}
+	}
+}
@@ -8,83 +8,28 @@ type dummyRouter struct {
 	Router
 }
 
-func TestGetMethodIndex(t *testing.T) {
-	r := &dummyRouter{}
-
-	tests := map[string]int{
-		"GET":     GET,
-		"POST":    POST,
-		"PUT":     PUT,
-		"DELETE":  DELETE,
-		"PATCH":   PATCH,
-		"HEAD":    HEAD,
-		"OPTIONS": OPTIONS,
-		"ANY":     ANY,
-		"INVALID": -128,
-	}
-
-	for method, expected := range tests {
-		got := r.getMethodIndex(method)
-		if got != expected {
-			t.Errorf("getMethodIndex(%q) = %d, want %d", method, got, expected)
-		}
-	}
-}
-
-func TestRemoveDuplicates(t *testing.T) {
-	input := []string{"GET", "POST", "GET", "DELETE", "POST"}
-	expected := []string{"GET", "POST", "DELETE"}
-	result := removeDuplicates(input)
-
-	if len(result) != len(expected) {
-		t.Fatalf("expected length %d, got %d", len(expected), len(result))
-	}
-	for i := range expected {
-		if result[i] != expected[i] {
-			t.Errorf("expected %s at index %d, got %s", expected[i], i, result[i])
-		}
-	}
-}
-
-func TestIndexToBit(t *testing.T) {
-	r := &dummyRouter{}
-	tests := map[int]int{
-		GET:     0,
-		POST:    1,
-		PUT:     2,
-		DELETE:  3,
-		PATCH:   4,
-		HEAD:    5,
-		OPTIONS: 6,
-		ANY:     7,
-		99:      7,
-	}
-
-	for input, expected := range tests {
-		got := r.indexToBit(input)
-		if got != expected {
-			t.Errorf("indexToBit(%d) = %d, want %d", input, got, expected)
-		}
-	}
-}
-
-func TestGetBitmaskIndex(t *testing.T) {
-	r := &dummyRouter{}
+func TestMethodBit(t *testing.T) {
 	tests := map[string]int{
-		"GET":     1,
-		"POST":    2,
-		"PUT":     4,
-		"DELETE":  8,
-		"PATCH":   16,
-		"HEAD":    32,
-		"OPTIONS": 64,
-		"UNKNOWN": 0,
+		"GET":      GET,
+		"POST":     POST,
+		"PUT":      PUT,
+		"DELETE":   DELETE,
+		"PATCH":    PATCH,
+		"HEAD":     HEAD,
+		"OPTIONS":  OPTIONS,
+		"ANY":      ANY,
+		"UNKNOWN":  ANY,
+		"":         ANY,
+		"get":      ANY,
+		"Post":     ANY,
+		"PROPFIND": ANY,
+		"GETX":     ANY,
+		"DEL":      ANY,
 	}
 
 	for method, expected := range tests {
-		got := r.getBitmaskIndex(method)
-		if got != expected {
-			t.Errorf("getBitmaskIndex(%q) = %d, want %d", method, got, expected)
+		if got := methodBit(method); got != expected {
+			t.Errorf("methodBit(%q) = %d, want %d", method, got, expected)
 		}
 	}
 }
@@ -100,7 +45,20 @@ func TestMethodsToBitmask(t *testing.T) {
 		{"GET POST ", GET | POST},
 		{"PUT DELETE POST ", PUT | DELETE | POST},
 		{"INVALID ", -1},
-		{"", 0},
+		{"", -1},
+		{"GET", GET},
+		{" GET ", GET},
+		{"GET,POST", GET | POST},
+		{"GET, POST", GET | POST},
+		{"GET POST", GET | POST},
+		{"GET,,POST,", GET | POST},
+		{" , ", -1},
+		{"GET,INVALID", -1},
+		{"ANY,GET", anyMethods},
+		{"GET GET", GET},
+		{"  POST   PUT", POST | PUT},
+		{"ANY", anyMethods},
+		{"GET ANY", anyMethods},
 	}
 
 	for _, tt := range tests {
@@ -111,29 +69,40 @@ func TestMethodsToBitmask(t *testing.T) {
 	}
 }
 
-func TestHandleRoute(t *testing.T) {
-	r := &dummyRouter{}
-	bitmask := GET | POST | PUT
-
-	tests := []struct {
-		method   string
-		expected bool
-	}{
-		{"GET", true},
-		{"POST", true},
-		{"DELETE", false},
-		{"PUT", true},
-		{"UNKNOWN", false},
+func methodBitSwitch(m string) int {
+	switch m {
+	case "GET":
+		return 1
+	case "POST":
+		return 2
+	case "PUT":
+		return 4
+	case "DELETE":
+		return 8
+	case "PATCH":
+		return 16
+	case "HEAD":
+		return 32
+	case "OPTIONS":
+		return 64
 	}
+	return 0
+}
 
-	for _, tt := range tests {
-		result := r.handleRoute(tt.method, bitmask)
-		if result != tt.expected {
-			t.Errorf("handleRoute(%q, %b) = %v, want %v", tt.method, bitmask, result, tt.expected)
-		}
+var benchMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS", "PROPFIND"}
+
+func BenchmarkMethodBitTable(b *testing.B) {
+	var sink int
+	for i := 0; i < b.N; i++ {
+		sink += methodBit(benchMethods[i&7])
 	}
+	_ = sink
+}
 
-	if !r.handleRoute("GET", ANY) {
-		t.Error("Expected handleRoute to return true for ANY method")
+func BenchmarkMethodBitSwitch(b *testing.B) {
+	var sink int
+	for i := 0; i < b.N; i++ {
+		sink += methodBitSwitch(benchMethods[i&7])
 	}
+	_ = sink
 }
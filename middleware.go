@@ -3,14 +3,17 @@ package router
 import (
 	"bufio"
 	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"fmt"
+	"io"
 	"mime"
 	"net"
 	"net/http"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 )
 
@@ -28,27 +31,79 @@ func (r *Router) Use(m Middleware) {
 }
 
 func (r *Router) useGroup(m Middleware, n string) {
+	r.mustNotBeSealed("Use")
+
 	r.middlewares[n] = append(r.middlewares[n], m)
+	r.rewrapRoutes()
+}
+
+func (r *Router) rewrapRoutes() {
+	for _, entries := range r.staticRoutes {
+		for i := range entries {
+			entries[i].wrapped = r.wrap(entries[i].Route, entries[i].Handler)
+		}
+	}
+
+	var walk func(n *RadixNode)
+	walk = func(n *RadixNode) {
+		for i := range n.entries {
+			n.entries[i].wrapped = r.wrap(n.entries[i].Route, n.entries[i].Handler)
+		}
+		for _, ch := range n.children {
+			walk(ch)
+		}
+	}
+	if r.radixRoot != nil {
+		walk(r.radixRoot)
+	}
+
+	for i := range r.fallbacks {
+		if r.fallbacks[i].handler != nil {
+			r.fallbacks[i].wrapped = r.wrap("", r.fallbacks[i].handler)
+		}
+	}
+
+	for _, a := range r.adapted {
+		a.wrapped = r.wrap("", a.handler)
+	}
+}
+
+func (r *Router) routeHandler(e *RouteEntry) HandlerFunc {
+	if e.wrapped != nil {
+		return e.wrapped
+	}
+	return r.wrap(e.Route, e.Handler)
 }
 
 func (r *Router) wrap(route string, h HandlerFunc) HandlerFunc {
+	h = skipIfAborted(h)
+
 	if gm, ok := r.groupMiddlewares[route]; ok && gm.Group != "" {
 		if mws, ok := r.middlewares[gm.Group]; ok {
 			for i := len(mws) - 1; i >= 0; i-- {
-				h = mws[i](h)
+				h = skipIfAborted(mws[i](h))
 			}
 		}
 	}
 
 	if mws, ok := r.middlewares[""]; ok {
 		for i := len(mws) - 1; i >= 0; i-- {
-			h = mws[i](h)
+			h = skipIfAborted(mws[i](h))
 		}
 	}
 
 	return h
 }
 
+func skipIfAborted(h HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, ctx *Context) {
+		if ctx.Aborted() {
+			return
+		}
+		h(w, r, ctx)
+	}
+}
+
 func AllowContentType(types ...string) Middleware {
 	allowed := make(map[string]struct{}, len(types))
 	for _, t := range types {
@@ -87,13 +142,91 @@ func CleanPath() Middleware {
 	}
 }
 
+// StripDuplicateSlashes returns a PreRoute hook that collapses repeated
+// slashes before the route lookup, leaving dot-segments untouched:
+//
+//	r.PreRoute(router.StripDuplicateSlashes())
+func StripDuplicateSlashes() func(w http.ResponseWriter, req *http.Request) bool {
+	return func(w http.ResponseWriter, req *http.Request) bool {
+		if strings.Contains(req.URL.Path, "//") {
+			req.URL.Path = collapseSlashes(req.URL.Path)
+			if req.URL.RawPath != "" {
+				req.URL.RawPath = collapseSlashes(req.URL.RawPath)
+			}
+		}
+		return true
+	}
+}
+
+func collapseSlashes(p string) string {
+	b := make([]byte, 0, len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && len(b) > 0 && b[len(b)-1] == '/' {
+			continue
+		}
+		b = append(b, p[i])
+	}
+	return string(b)
+}
+
 func GetHead() Middleware {
 	return func(next HandlerFunc) HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request, c *Context) {
-			if r.Method == http.MethodHead {
-				r.Method = http.MethodGet
+			if r.Method != http.MethodHead {
+				next(w, r, c)
+				return
 			}
-			next(w, r, c)
+
+			r.Method = http.MethodGet
+			if _, ok := w.(*headWriter); ok {
+				next(w, r, c)
+				return
+			}
+
+			hw := &headWriter{ResponseWriter: w}
+			next(hw, r, c)
+			hw.finish()
+		}
+	}
+}
+
+var MaxDecompressedBytes int64 = 10 << 20
+
+type gzipRequestBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipRequestBody) Close() error {
+	_ = b.Reader.Close()
+	return b.body.Close()
+}
+
+func DecompressRequest() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, ctx *Context) {
+			if r.Body == nil || r.Body == http.NoBody || !strings.EqualFold(strings.TrimSpace(r.Header.Get("Content-Encoding")), "gzip") {
+				next(w, r, ctx)
+				return
+			}
+
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				ctx.AbortWithStatus(w, http.StatusBadRequest)
+				return
+			}
+
+			var body io.ReadCloser = &gzipRequestBody{Reader: gz, body: r.Body}
+			if MaxDecompressedBytes > 0 {
+				body = http.MaxBytesReader(w, body, MaxDecompressedBytes)
+			}
+
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+
+			next(w, r, ctx)
 		}
 	}
 }
@@ -114,15 +247,13 @@ func ContentCharset(charsets ...string) Middleware {
 
 			_, params, err := mime.ParseMediaType(ct)
 			if err != nil {
-				http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
-				ctx.Abort()
+				ctx.AbortWithStatus(w, http.StatusUnsupportedMediaType)
 				return
 			}
 
 			cs := strings.ToLower(params["charset"])
 			if _, ok := allowed[cs]; !ok {
-				http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
-				ctx.Abort()
+				ctx.AbortWithStatus(w, http.StatusUnsupportedMediaType)
 				return
 			}
 
@@ -131,13 +262,104 @@ func ContentCharset(charsets ...string) Middleware {
 	}
 }
 
+const HeaderNoCompress = "X-No-Compress"
+
+type compressWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+type compressEncoding struct {
+	name      string
+	pools     [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+	newWriter func(w io.Writer, level int) compressWriter
+}
+
+var (
+	gzipEncoding = &compressEncoding{
+		name: "gzip",
+		newWriter: func(w io.Writer, level int) compressWriter {
+			gz, _ := gzip.NewWriterLevel(w, level)
+			return gz
+		},
+	}
+	deflateEncoding = &compressEncoding{
+		name: "deflate",
+		newWriter: func(w io.Writer, level int) compressWriter {
+			zw, _ := zlib.NewWriterLevel(w, level)
+			return zw
+		},
+	}
+	compressEncodings = []*compressEncoding{gzipEncoding, deflateEncoding}
+)
+
+func (e *compressEncoding) acquire(w io.Writer, level int) compressWriter {
+	if cw, ok := e.pools[level-gzip.HuffmanOnly].Get().(compressWriter); ok {
+		cw.Reset(w)
+		return cw
+	}
+	return e.newWriter(w, level)
+}
+
+func (e *compressEncoding) release(cw compressWriter, level int) {
+	cw.Reset(io.Discard)
+	e.pools[level-gzip.HuffmanOnly].Put(cw)
+}
+
+func negotiateEncoding(acceptEncoding string) *compressEncoding {
+	if acceptEncoding == "" {
+		return nil
+	}
+
+	var best *compressEncoding
+	bestQ := 0.0
+
+	for _, e := range compressEncodings {
+		q := encodingQuality(acceptEncoding, e.name)
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+func encodingQuality(acceptEncoding, name string) float64 {
+	wildcard := -1.0
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		token, params, _ := strings.Cut(part, ";")
+		token = strings.TrimSpace(token)
+
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.EqualFold(strings.TrimSpace(k), "q") {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = f
+			}
+		}
+
+		switch {
+		case strings.EqualFold(token, name):
+			return q
+		case token == "*":
+			wildcard = q
+		}
+	}
+
+	if wildcard > 0 {
+		return wildcard
+	}
+	return 0
+}
+
 type compressResponseWriter struct {
 	http.ResponseWriter
-	types    map[string]struct{}
-	level    int
-	gz       *gzip.Writer
-	status   int
-	wroteHdr bool
+	types      map[string]struct{}
+	level      int
+	encoding   *compressEncoding
+	enc        compressWriter
+	status     int
+	wroteHdr   bool
+	noCompress bool
 }
 
 func (cw *compressResponseWriter) WriteHeader(status int) {
@@ -146,6 +368,19 @@ func (cw *compressResponseWriter) WriteHeader(status int) {
 	}
 	cw.wroteHdr = true
 	cw.status = status
+
+	if cw.Header().Get(HeaderNoCompress) != "" {
+		cw.Header().Del(HeaderNoCompress)
+		cw.noCompress = true
+	}
+	if status == http.StatusPartialContent || cw.Header().Get("Content-Range") != "" {
+		cw.noCompress = true
+	}
+
+	if !cw.noCompress && status >= 200 && status < 300 && status != http.StatusNoContent && cw.allowedType() {
+		cw.enableEncoding()
+	}
+
 	cw.ResponseWriter.WriteHeader(status)
 }
 
@@ -167,48 +402,45 @@ func (cw *compressResponseWriter) Push(target string, opts *http.PushOptions) er
 	return http.ErrNotSupported
 }
 
-func (cw *compressResponseWriter) enableGzip() {
-	if cw.gz != nil {
+func (cw *compressResponseWriter) allowedType() bool {
+	ct := cw.Header().Get("Content-Type")
+	if i := strings.Index(ct, ";"); i >= 0 {
+		ct = ct[:i]
+	}
+	ct = strings.ToLower(strings.TrimSpace(ct))
+
+	_, ok := cw.types[ct]
+	return ok
+}
+
+func (cw *compressResponseWriter) enableEncoding() {
+	if cw.enc != nil {
 		return
 	}
 
 	cw.Header().Del("Content-Length")
-	cw.Header().Set("Content-Encoding", "gzip")
+	cw.Header().Set("Content-Encoding", cw.encoding.name)
+
+	cw.enc = cw.encoding.acquire(cw.ResponseWriter, cw.level)
+}
 
-	gz, err := gzip.NewWriterLevel(cw.ResponseWriter, cw.level)
-	if err != nil {
+func (cw *compressResponseWriter) close() {
+	if cw.enc == nil {
 		return
 	}
-	cw.gz = gz
+	_ = cw.enc.Close()
+	cw.encoding.release(cw.enc, cw.level)
+	cw.enc = nil
 }
 
 func (cw *compressResponseWriter) Write(b []byte) (int, error) {
 
 	if !cw.wroteHdr {
-		cw.status = http.StatusOK
-		cw.WriteHeader(cw.status)
+		cw.WriteHeader(http.StatusOK)
 	}
 
-	if cw.status < 200 || cw.status >= 300 || cw.status == 204 {
-		return cw.ResponseWriter.Write(b)
-	}
-
-	if cw.gz == nil {
-		ct := cw.Header().Get("Content-Type")
-		if i := strings.Index(ct, ";"); i >= 0 {
-			ct = ct[:i]
-		}
-		ct = strings.ToLower(strings.TrimSpace(ct))
-
-		if _, ok := cw.types[ct]; !ok {
-			return cw.ResponseWriter.Write(b)
-		}
-
-		cw.enableGzip()
-	}
-
-	if cw.gz != nil {
-		return cw.gz.Write(b)
+	if cw.enc != nil {
+		return cw.enc.Write(b)
 	}
 
 	return cw.ResponseWriter.Write(b)
@@ -241,12 +473,13 @@ func Compress(level int, types ...string) Middleware {
 
 	return func(next HandlerFunc) HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request, c *Context) {
-			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == nil {
 				next(w, r, c)
 				return
 			}
 
-			if r.Method == http.MethodHead {
+			if r.Method == http.MethodHead || r.Header.Get("Range") != "" || isUpgradeRequest(r) {
 				next(w, r, c)
 				return
 			}
@@ -255,16 +488,13 @@ func Compress(level int, types ...string) Middleware {
 				ResponseWriter: w,
 				types:          allowed,
 				level:          level,
+				encoding:       encoding,
 			}
-			defer func() {
-				if cw.gz != nil {
-					_ = cw.gz.Close()
-				}
-			}()
+			defer cw.close()
 
 			next(cw, r, c)
 
-			if cw.gz != nil {
+			if cw.enc != nil {
 				if fl, ok := w.(http.Flusher); ok {
 					fl.Flush()
 				}
@@ -273,6 +503,20 @@ func Compress(level int, types ...string) Middleware {
 	}
 }
 
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") != "" {
+		return true
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type CORSOptions struct {
 	AllowedOrigins   []string
 	AllowedMethods   []string
@@ -293,7 +537,11 @@ func matchOrigin(origin string, patterns []string) bool {
 		if p == "*" {
 			return true
 		}
-		if strings.HasSuffix(p, "*") {
+		if i := strings.Index(p, "://*."); i >= 0 {
+			if matchSubdomain(origin, p[:i+3], p[i+4:]) {
+				return true
+			}
+		} else if strings.HasSuffix(p, "*") {
 			prefix := strings.TrimSuffix(p, "*")
 			if strings.HasPrefix(origin, prefix) {
 				return true
@@ -305,6 +553,53 @@ func matchOrigin(origin string, patterns []string) bool {
 	return false
 }
 
+func matchSubdomain(origin, scheme, suffix string) bool {
+	if !strings.HasPrefix(origin, scheme) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	label := origin[len(scheme) : len(origin)-len(suffix)]
+	return label != "" && !strings.ContainsAny(label, ".:/")
+}
+
+func corsCredentials(opts *CORSOptions, origin string) bool {
+	if !opts.AllowCredentials {
+		return false
+	}
+	for _, p := range opts.AllowedOrigins {
+		if strings.TrimSpace(p) != "*" && matchOrigin(origin, []string{p}) {
+			return true
+		}
+	}
+	return false
+}
+
+func addVary(h http.Header, keys ...string) {
+	existing := h.Values("Vary")
+
+next:
+	for _, key := range keys {
+		for _, v := range existing {
+			for _, token := range strings.Split(v, ",") {
+				token = strings.TrimSpace(token)
+				if token == "*" || strings.EqualFold(token, key) {
+					continue next
+				}
+			}
+		}
+		h.Add("Vary", key)
+		existing = append(existing, key)
+	}
+}
+
+func hasBareWildcard(patterns []string) bool {
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "*" {
+			return true
+		}
+	}
+	return false
+}
+
 func CORS(opts CORSOptions) Middleware {
 	allowedMethods := strings.Join(opts.AllowedMethods, ", ")
 	allowedHeaders := strings.Join(opts.AllowedHeaders, ", ")
@@ -314,6 +609,10 @@ func CORS(opts CORSOptions) Middleware {
 		maxAge = strconv.Itoa(opts.MaxAge)
 	}
 
+	if opts.AllowCredentials && hasBareWildcard(opts.AllowedOrigins) {
+		pkgLog().Warn("CORS: AllowCredentials is not sent for origins matched only by \"*\"")
+	}
+
 	return func(next HandlerFunc) HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request, c *Context) {
 			origin := r.Header.Get("Origin")
@@ -328,10 +627,10 @@ func CORS(opts CORSOptions) Middleware {
 			}
 
 			h := w.Header()
-			h.Set("Vary", "Origin")
+			addVary(h, "Origin")
 			h.Set("Access-Control-Allow-Origin", origin)
 
-			if opts.AllowCredentials {
+			if corsCredentials(&opts, origin) {
 				h.Set("Access-Control-Allow-Credentials", "true")
 			}
 
@@ -342,6 +641,8 @@ func CORS(opts CORSOptions) Middleware {
 					return
 				}
 
+				addVary(h, "Access-Control-Request-Method", "Access-Control-Request-Headers")
+
 				if allowedMethods != "" {
 					h.Set("Access-Control-Allow-Methods", allowedMethods)
 				}
@@ -370,6 +671,7 @@ type ctxKey string
 const (
 	ContextKeyRequestID ctxKey = "request_id"
 	ContextKeyRealIP    ctxKey = "real_ip"
+	ContextKeyContext   ctxKey = "router_context"
 )
 
 var reqIDCounter uint64
@@ -387,10 +689,7 @@ func RequestID() Middleware {
 				id = nextRequestID()
 			}
 
-			ctx := context.WithValue(r.Context(), ContextKeyRequestID, id)
-			r = r.WithContext(ctx)
-
-			c.Set("request_id", id)
+			r = c.setRequestValue(r, ContextKeyRequestID, id)
 
 			w.Header().Set("X-Request-ID", id)
 
@@ -413,46 +712,19 @@ func GetRequestID(r *http.Request) string {
 func RealIP() Middleware {
 	return func(next HandlerFunc) HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request, c *Context) {
-			ip := realIPFromRequest(r)
+			ip := c.clientIP(r)
 
 			if ip != "" {
 				r.RemoteAddr = ip
 			}
 
-			ctx := context.WithValue(r.Context(), ContextKeyRealIP, ip)
-			r = r.WithContext(ctx)
-
-			c.Set("real_ip", ip)
+			r = c.setRequestValue(r, ContextKeyRealIP, ip)
 
 			next(w, r, c)
 		}
 	}
 }
 
-func realIPFromRequest(r *http.Request) string {
-
-	if rip := strings.TrimSpace(r.Header.Get("X-Real-IP")); rip != "" {
-		return rip
-	}
-
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		if len(parts) > 0 {
-			ip := strings.TrimSpace(parts[0])
-			if ip != "" {
-				return ip
-			}
-		}
-	}
-
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err == nil && host != "" {
-		return host
-	}
-
-	return r.RemoteAddr
-}
-
 func GetRealIP(r *http.Request) string {
 	v := r.Context().Value(ContextKeyRealIP)
 	if v == nil {
@@ -464,6 +736,31 @@ func GetRealIP(r *http.Request) string {
 	return ""
 }
 
+func WrapHTTP(mw func(http.Handler) http.Handler) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, c *Context) {
+			inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rc := ContextFromRequest(r)
+				if rc == nil {
+					rc = c
+				}
+				rc.Request = r
+				next(w, r, rc)
+			})
+
+			r = r.WithContext(context.WithValue(r.Context(), ContextKeyContext, c))
+			mw(inner).ServeHTTP(w, r)
+		}
+	}
+}
+
+func ContextFromRequest(r *http.Request) *Context {
+	if c, ok := r.Context().Value(ContextKeyContext).(*Context); ok {
+		return c
+	}
+	return nil
+}
+
 func NoCache() Middleware {
 	return func(next HandlerFunc) HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request, c *Context) {
@@ -1,13 +1,19 @@
 package router
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
+	"compress/zlib"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func newTestContext() *Context {
@@ -298,6 +304,13 @@ func TestMatchOrigin(t *testing.T) {
 		{"https://api.test.com", []string{"https://api.test.com"}, true},
 		{"https://api.test.com", []string{"https://other.com"}, false},
 		{"", []string{"*"}, false},
+		{"https://a.example.com", []string{"https://*.example.com"}, true},
+		{"https://a.b.example.com", []string{"https://*.example.com"}, false},
+		{"https://example.com", []string{"https://*.example.com"}, false},
+		{"http://a.example.com", []string{"https://*.example.com"}, false},
+		{"https://a.example.com:8443", []string{"https://*.example.com"}, false},
+		{"https://a.example.com:8443", []string{"https://*.example.com:8443"}, true},
+		{"https://evil.com/.example.com", []string{"https://*.example.com"}, false},
 	}
 
 	for i, tt := range tests {
@@ -456,21 +469,74 @@ func TestRequestIDUsesExistingHeader(t *testing.T) {
 	}
 }
 
+func TestMiddlewareRunsForStaticAndDynamicRoutes(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.Use(RequestID())
+
+	api := r.Group("/api")
+	api.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			w.Header().Set("X-Group", "api")
+			next(w, req, ctx)
+		}
+	})
+
+	ok := func(w http.ResponseWriter, req *http.Request, ctx *Context) { w.WriteHeader(http.StatusOK) }
+	r.HandleFunc("/health", "GET", ok)
+	r.HandleFunc("/users/<id>", "GET", ok)
+	r.HandleFunc("/orders/<id:isDigits>", "GET", ok)
+	api.HandleFunc("/status", "GET", ok)
+	api.HandleFunc("/users/<id>", "GET", ok)
+
+	cases := []struct {
+		path  string
+		group bool
+	}{
+		{"/health", false},
+		{"/users/42", false},
+		{"/orders/7", false},
+		{"/api/status", true},
+		{"/api/users/42", true},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+		if w.Code != http.StatusOK || w.Header().Get("X-Request-ID") == "" {
+			t.Errorf("%s: expected global middleware to set X-Request-ID, got %d %v", tc.path, w.Code, w.Header())
+		}
+		if got := w.Header().Get("X-Group") == "api"; got != tc.group {
+			t.Errorf("%s: group middleware ran=%v, want %v", tc.path, got, tc.group)
+		}
+	}
+}
+
+func trustTestProxy() *Router {
+	r := NewRouter().(*Router)
+	r.SetTrustedProxies([]string{"192.0.2.0/24"})
+	return r
+}
+
 func TestRealIPFromXRealIP(t *testing.T) {
+	r := trustTestProxy()
+
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	req.Header.Set("X-Real-IP", "1.2.3.4")
 
-	if got := realIPFromRequest(req); got != "1.2.3.4" {
-		t.Fatalf("realIPFromRequest = %q, want %q", got, "1.2.3.4")
+	if got := r.clientIP(req); got != "1.2.3.4" {
+		t.Fatalf("clientIP = %q, want %q", got, "1.2.3.4")
 	}
 }
 
 func TestRealIPFromXForwardedFor(t *testing.T) {
+	r := trustTestProxy()
+
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	req.Header.Set("X-Forwarded-For", "5.6.7.8, 9.10.11.12")
+	req.Header.Set("X-Forwarded-For", "5.6.7.8")
 
-	if got := realIPFromRequest(req); got != "5.6.7.8" {
-		t.Fatalf("realIPFromRequest = %q, want %q", got, "5.6.7.8")
+	if got := r.clientIP(req); got != "5.6.7.8" {
+		t.Fatalf("clientIP = %q, want %q", got, "5.6.7.8")
 	}
 }
 
@@ -478,12 +544,34 @@ func TestRealIPFromRemoteAddr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	req.RemoteAddr = net.JoinHostPort("10.0.0.1", "12345")
 
-	if got := realIPFromRequest(req); got != "10.0.0.1" {
-		t.Fatalf("realIPFromRequest = %q, want %q", got, "10.0.0.1")
+	if got := NewRouter().(*Router).clientIP(req); got != "10.0.0.1" {
+		t.Fatalf("clientIP = %q, want %q", got, "10.0.0.1")
+	}
+}
+
+func TestRealIPIgnoresHeadersFromUntrustedPeers(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.50:4000"
+	req.Header.Set("X-Real-IP", "1.2.3.4")
+	req.Header.Set("X-Forwarded-For", "5.6.7.8")
+
+	if got := trustTestProxy().clientIP(req); got != "203.0.113.50" {
+		t.Fatalf("clientIP = %q, want socket address %q", got, "203.0.113.50")
+	}
+
+	var captured string
+	h := RealIP()(func(w http.ResponseWriter, r *http.Request, c *Context) {
+		captured = GetRealIP(r)
+	})
+	h(httptest.NewRecorder(), req, newTestContext())
+
+	if captured != "203.0.113.50" {
+		t.Fatalf("RealIP trusted spoofed headers: got %q", captured)
 	}
 }
 
 func TestRealIPMiddleware(t *testing.T) {
+	r := trustTestProxy()
 	m := RealIP()
 
 	var capturedIP string
@@ -499,7 +587,7 @@ func TestRealIPMiddleware(t *testing.T) {
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	req.Header.Set("X-Real-IP", "123.123.123.123")
-	ctx := newTestContext()
+	ctx := &Context{router: r}
 
 	h(rr, req, ctx)
 
@@ -533,3 +621,703 @@ func TestNoCache(t *testing.T) {
 		t.Fatalf("Expires not set")
 	}
 }
+
+func TestCompressSkipsWhenHandlerOptsOut(t *testing.T) {
+	m := Compress(gzip.DefaultCompression, "application/json")
+
+	h := m(func(w http.ResponseWriter, r *http.Request, c *Context) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(HeaderNoCompress, "1")
+		_, _ = w.Write([]byte(`{"precompressed":true}`))
+	})
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	h(rr, req, newTestContext())
+
+	if enc := rr.Header().Get("Content-Encoding"); enc != "" {
+		t.Fatalf("expected no Content-Encoding, got %q", enc)
+	}
+	if hint := rr.Header().Get(HeaderNoCompress); hint != "" {
+		t.Fatalf("expected %s to be stripped, got %q", HeaderNoCompress, hint)
+	}
+	if body := rr.Body.String(); body != `{"precompressed":true}` {
+		t.Fatalf("unexpected body: %q", body)
+	}
+}
+
+func TestStripDuplicateSlashes(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.PreRoute(StripDuplicateSlashes())
+	r.HandleFunc("/a/b", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte(req.URL.Path))
+	})
+	r.HandleFunc("/u/<id>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		id, _ := ctx.Param("id")
+		_, _ = w.Write([]byte("u:" + id))
+	})
+	r.HandleFunc("/a/./b", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte("dot"))
+	})
+
+	tests := []struct {
+		in, want string
+	}{
+		{"/a//b", "/a/b"},
+		{"//a/b", "/a/b"},
+		{"/a///b", "/a/b"},
+		{"/u//5", "u:5"},
+		{"/u//a%2Fb", "u:a/b"},
+		{"/a/.//b", "dot"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.in, nil))
+
+		if w.Code != http.StatusOK || w.Body.String() != tt.want {
+			t.Errorf("%s: got %d %q, want %q", tt.in, w.Code, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestWrapHTTP(t *testing.T) {
+	std := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Std", "1")
+			if ContextFromRequest(r) == nil {
+				t.Errorf("router context not reachable from std middleware")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	c := newTestContext()
+	var got *Context
+	h := WrapHTTP(std)(func(w http.ResponseWriter, r *http.Request, ctx *Context) {
+		got = ctx
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	h(rec, req, c)
+
+	if got != c {
+		t.Fatalf("handler did not receive the original *Context")
+	}
+	if rec.Header().Get("X-Std") != "1" {
+		t.Fatalf("std middleware did not run")
+	}
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTeapot)
+	}
+}
+
+func TestWrapHTTPShortCircuit(t *testing.T) {
+	deny := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		})
+	}
+
+	var called bool
+	h := WrapHTTP(deny)(makeTrackingHandler(&called))
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/", nil), newTestContext())
+
+	if called {
+		t.Fatalf("handler must not run when std middleware short-circuits")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestCompressLeavesUpgradeRequestsHijackable(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.Use(DefaultCompress())
+
+	r.HandleFunc("/ws", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		if _, ok := w.(*compressResponseWriter); ok {
+			t.Errorf("Compress must not wrap upgrade requests")
+		}
+
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Errorf("writer does not implement http.Hijacker")
+			return
+		}
+
+		conn, buf, err := hj.Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\nhello")
+		_ = buf.Flush()
+	})
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	_, _ = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: example.com\r\nAccept-Encoding: gzip\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("reading response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("upgrade response must not be compressed")
+	}
+}
+
+func TestAbortWithStatusAndJSON(t *testing.T) {
+	ctx := newTestContext()
+	rec := httptest.NewRecorder()
+	ctx.AbortWithStatus(rec, http.StatusForbidden)
+	if !ctx.Aborted() || rec.Code != http.StatusForbidden || !bytes.Contains(rec.Body.Bytes(), []byte("Forbidden")) {
+		t.Fatalf("AbortWithStatus: aborted=%v code=%d body=%q", ctx.Aborted(), rec.Code, rec.Body.String())
+	}
+
+	ctx = newTestContext()
+	rec = httptest.NewRecorder()
+	ctx.AbortWithJSON(rec, http.StatusUnauthorized, map[string]string{"error": "login required"})
+	if !ctx.Aborted() || rec.Code != http.StatusUnauthorized || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("AbortWithJSON: aborted=%v code=%d type=%q", ctx.Aborted(), rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestAbortStopsHandler(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			ctx.AbortWithStatus(w, http.StatusForbidden)
+			next(w, req, ctx)
+		}
+	})
+
+	var called bool
+	r.HandleFunc("/secret", "GET", makeTrackingHandler(&called))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/secret", nil))
+
+	if called {
+		t.Fatalf("handler ran after the middleware aborted")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestAbortShortCircuitsEveryMiddlewareLink(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	var trace []string
+	record := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+				trace = append(trace, name+":before")
+				next(w, req, ctx)
+				trace = append(trace, name+":after")
+			}
+		}
+	}
+
+	r.Use(record("outer"))
+	r.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			ctx.Abort()
+			w.WriteHeader(http.StatusForbidden)
+			next(w, req, ctx) // mistake: must not continue the chain
+		}
+	})
+	r.Use(record("global-inner"))
+
+	api := r.Group("/api")
+	api.Use(record("group"))
+
+	var called bool
+	api.HandleFunc("/secret", "GET", makeTrackingHandler(&called))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/secret", nil))
+
+	if called {
+		t.Fatalf("handler ran after abort")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	want := []string{"outer:before", "outer:after"}
+	if len(trace) != len(want) || trace[0] != want[0] || trace[1] != want[1] {
+		t.Fatalf("trace = %v, want %v", trace, want)
+	}
+}
+
+func TestCORSCredentialsNeverWithBareWildcard(t *testing.T) {
+	tests := []struct {
+		origins []string
+		origin  string
+		want    string
+	}{
+		{[]string{"*"}, "https://evil.com", ""},
+		{[]string{"*", "https://*.example.com"}, "https://evil.com", ""},
+		{[]string{"*", "https://*.example.com"}, "https://app.example.com", "true"},
+		{[]string{"https://app.example.com"}, "https://app.example.com", "true"},
+	}
+
+	SetLogger(&recordingLogger{})
+	defer SetLogger(nil)
+
+	for _, tt := range tests {
+		h := CORS(CORSOptions{AllowedOrigins: tt.origins, AllowCredentials: true})(func(w http.ResponseWriter, r *http.Request, ctx *Context) {})
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.Header.Set("Origin", tt.origin)
+		h(rr, req, newTestContext())
+
+		if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != tt.want {
+			t.Errorf("origins=%v origin=%s: Allow-Credentials = %q, want %q", tt.origins, tt.origin, got, tt.want)
+		}
+		if rr.Header().Get("Access-Control-Allow-Origin") != tt.origin {
+			t.Errorf("origins=%v origin=%s: origin should still be allowed", tt.origins, tt.origin)
+		}
+	}
+}
+
+func TestAddVaryDeduplicates(t *testing.T) {
+	h := http.Header{}
+	h.Set("Vary", "Accept-Encoding, origin")
+
+	addVary(h, "Origin", "Access-Control-Request-Method")
+	addVary(h, "Access-Control-Request-Method")
+
+	got := h.Values("Vary")
+	want := []string{"Accept-Encoding, origin", "Access-Control-Request-Method"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("Vary = %q, want %q", got, want)
+	}
+}
+
+func TestCORSVaryHeaders(t *testing.T) {
+	h := CORS(CORSOptions{AllowedOrigins: []string{"https://*"}})(func(w http.ResponseWriter, r *http.Request, ctx *Context) {})
+
+	varyOf := func(method string, preflight bool) []string {
+		rr := httptest.NewRecorder()
+		rr.Header().Set("Vary", "Accept-Encoding")
+		req := httptest.NewRequest(method, "/api", nil)
+		req.Header.Set("Origin", "https://example.com")
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		h(rr, req, newTestContext())
+		return rr.Header().Values("Vary")
+	}
+
+	if got := varyOf(http.MethodGet, false); strings.Join(got, "|") != "Accept-Encoding|Origin" {
+		t.Errorf("simple request Vary = %q", got)
+	}
+
+	want := "Accept-Encoding|Origin|Access-Control-Request-Method|Access-Control-Request-Headers"
+	if got := varyOf(http.MethodOptions, true); strings.Join(got, "|") != want {
+		t.Errorf("preflight Vary = %q, want %q", got, want)
+	}
+}
+
+func TestClientIPWalksForwardedForFromTheRight(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.SetTrustedProxies([]string{"10.0.0.0/8"})
+
+	tests := []struct {
+		name string
+		xff  []string
+		hops int
+		want string
+	}{
+		{"multi hop", []string{"198.51.100.1, 10.0.0.2, 10.0.0.3"}, 0, "198.51.100.1"},
+		{"spoofed leftmost", []string{"1.1.1.1, 198.51.100.1, 10.0.0.3"}, 0, "198.51.100.1"},
+		{"split headers", []string{"1.1.1.1, 198.51.100.1", "10.0.0.3"}, 0, "198.51.100.1"},
+		{"all trusted", []string{"10.0.0.1, 10.0.0.2"}, 0, "10.0.0.1"},
+		{"hop count", []string{"1.1.1.1, 198.51.100.1, 203.0.113.7"}, 2, "198.51.100.1"},
+		{"hop count exceeds chain", []string{"198.51.100.1"}, 3, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		r.SetTrustedHops(tt.hops)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.4:443"
+		for _, v := range tt.xff {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+
+		if got := r.clientIP(req); got != tt.want {
+			t.Errorf("%s: clientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClientIPHandlesIPv6(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.SetTrustedProxies([]string{"2001:db8:ffff::/48", "10.0.0.0/8"})
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"bracketed with port", "[2001:db8::1]:443", "", "2001:db8::1"},
+		{"bare ipv6", "2001:db8::1", "", "2001:db8::1"},
+		{"zone", "[fe80::1%eth0]:80", "", "fe80::1"},
+		{"ipv4-mapped", "[::ffff:198.51.100.9]:80", "", "198.51.100.9"},
+		{"non-canonical", "[2001:DB8:0:0::1]:80", "", "2001:db8::1"},
+		{"xff bracketed with port", "[2001:db8:ffff::1]:443", "[2001:db8::7]:5555", "2001:db8::7"},
+		{"xff ipv6 behind ipv6 proxy", "[2001:db8:ffff::1]:443", "2001:db8::7, 2001:db8:ffff::2", "2001:db8::7"},
+		{"xff ipv4 with port", "10.0.0.1:443", "198.51.100.1:1234", "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+
+		if got := r.clientIP(req); got != tt.want {
+			t.Errorf("%s: clientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompressSkipsPartialContent(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.Use(Compress(gzip.DefaultCompression, "text/plain"))
+	r.HandleFunc("/video", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		w.Header().Set("Content-Type", "text/plain")
+		http.ServeContent(w, req, "video.txt", time.Time{}, strings.NewReader("0123456789"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/video", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+		t.Errorf("expected 206 %q, got %d %q", "2345", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("range responses must not be compressed")
+	}
+
+	rec := &compressResponseWriter{ResponseWriter: httptest.NewRecorder(), types: map[string]struct{}{"text/plain": {}}}
+	rec.Header().Set("Content-Range", "bytes 0-1/2")
+	rec.WriteHeader(http.StatusPartialContent)
+	if !rec.noCompress {
+		t.Errorf("expected 206 responses to disable compression")
+	}
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func TestDecompressRequest(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.Use(DecompressRequest())
+	r.HandleFunc("/ingest", "POST", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		var payload struct {
+			Temp int `json:"temp"`
+		}
+		if err := BindJSON(req, &payload); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		_, _ = w.Write([]byte(req.Header.Get("Content-Encoding") + strconv.Itoa(payload.Temp)))
+	})
+
+	post := func(body []byte, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(gzipBytes(t, []byte(`{"temp":21}`)), "gzip"); w.Code != http.StatusOK || w.Body.String() != "21" {
+		t.Errorf("gzip body: got %d %q", w.Code, w.Body.String())
+	}
+	if w := post([]byte(`{"temp":7}`), ""); w.Code != http.StatusOK || w.Body.String() != "7" {
+		t.Errorf("plain body: got %d %q", w.Code, w.Body.String())
+	}
+	if w := post([]byte("not gzip at all"), "gzip"); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed gzip: expected 400, got %d", w.Code)
+	}
+
+	old := MaxDecompressedBytes
+	MaxDecompressedBytes = 64
+	defer func() { MaxDecompressedBytes = old }()
+
+	bomb := gzipBytes(t, []byte(`{"temp":1,"pad":"`+strings.Repeat("A", 4096)+`"}`))
+	if w := post(bomb, "gzip"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: expected the read to fail, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCompressReusesPooledWritersCleanly(t *testing.T) {
+	m := Compress(gzip.BestSpeed, "text/plain")
+	h := m(func(w http.ResponseWriter, r *http.Request, c *Context) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.URL.Query().Get("body")))
+	})
+
+	for _, body := range []string{"first response", "second", strings.Repeat("third ", 100)} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/?body="+url.QueryEscape(body), nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		h(rr, req, newTestContext())
+
+		gr, err := gzip.NewReader(rr.Body)
+		if err != nil {
+			t.Fatalf("gzip reader: %v", err)
+		}
+		got, err := io.ReadAll(gr)
+		if err != nil {
+			t.Fatalf("reading gzip body: %v", err)
+		}
+		if string(got) != body {
+			t.Fatalf("expected %q, got %q", body, got)
+		}
+	}
+}
+
+func BenchmarkCompressGzip(b *testing.B) {
+	payload := []byte(strings.Repeat("<p>hello compressed world</p>", 64))
+	h := DefaultCompress()(func(w http.ResponseWriter, r *http.Request, c *Context) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write(payload)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	ctx := newTestContext()
+	w := &discardResponseWriter{header: http.Header{}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h(w, req, ctx)
+	}
+}
+
+func TestCompressDeflate(t *testing.T) {
+	h := Compress(gzip.DefaultCompression, "text/plain")(func(w http.ResponseWriter, r *http.Request, c *Context) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("hello deflate"))
+	})
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "deflate")
+	h(rr, req, newTestContext())
+
+	if enc := rr.Header().Get("Content-Encoding"); enc != "deflate" {
+		t.Fatalf("expected Content-Encoding deflate, got %q", enc)
+	}
+
+	fr, err := zlib.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("zlib reader: %v", err)
+	}
+	defer func() { _ = fr.Close() }()
+
+	got, err := io.ReadAll(fr)
+	if err != nil {
+		t.Fatalf("reading deflate body: %v", err)
+	}
+	if string(got) != "hello deflate" {
+		t.Fatalf("expected %q, got %q", "hello deflate", got)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip, deflate, br", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0.1", "deflate"},
+		{"gzip;q=0", ""},
+		{"identity", ""},
+		{"*", "gzip"},
+		{"*;q=0.5, gzip;q=0", "deflate"},
+		{"GZIP", "gzip"},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if e := negotiateEncoding(tt.accept); e != nil {
+			got = e.name
+		}
+		if got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestCompressSendsContentEncodingOverTheWire(t *testing.T) {
+	h := DefaultCompress()(func(w http.ResponseWriter, r *http.Request, c *Context) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<p>on the wire</p>"))
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, newTestContext())
+	}))
+	defer srv.Close()
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.Header.Set("Accept-Encoding", encoding)
+
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		if got := resp.Header.Get("Content-Encoding"); got != encoding {
+			t.Fatalf("expected Content-Encoding %q on the response, got %q", encoding, got)
+		}
+
+		var dec io.Reader
+		if encoding == "gzip" {
+			dec, err = gzip.NewReader(bytes.NewReader(body))
+		} else {
+			dec, err = zlib.NewReader(bytes.NewReader(body))
+		}
+		if err != nil {
+			t.Fatalf("%s reader: %v", encoding, err)
+		}
+		if got, _ := io.ReadAll(dec); string(got) != "<p>on the wire</p>" {
+			t.Fatalf("unexpected decoded %s body %q", encoding, got)
+		}
+	}
+}
+
+func TestContextRequestIDAndRealIPAccessors(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.Use(RequestID())
+	r.Use(RealIP())
+
+	var id, ip, reqID, reqIP string
+	r.HandleFunc("/whoami", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		id, ip = ctx.RequestID(), ctx.RealIP()
+		reqID, reqIP = GetRequestID(req), GetRealIP(req)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("X-Request-ID", "req-9")
+	req.RemoteAddr = "203.0.113.7:4321"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if id != "req-9" || reqID != id {
+		t.Fatalf("request id drifted: ctx=%q request=%q", id, reqID)
+	}
+	if ip != "203.0.113.7" || reqIP != ip {
+		t.Fatalf("real ip drifted: ctx=%q request=%q", ip, reqIP)
+	}
+
+	ctx := newTestContext()
+	ctx.Set("request_id", "manual")
+	if got := ctx.RequestID(); got != "manual" {
+		t.Fatalf("expected the ctx value as a fallback, got %q", got)
+	}
+	if got := ctx.RealIP(); got != "" {
+		t.Fatalf("expected no real ip, got %q", got)
+	}
+}
+
+func TestUseAfterRoutesRewrapsCachedHandlers(t *testing.T) {
+	r := NewRouter().(*Router)
+	api := r.Group("/api")
+
+	ok := func(w http.ResponseWriter, req *http.Request, ctx *Context) { w.WriteHeader(http.StatusOK) }
+	r.HandleFunc("/health", "GET", ok)
+	api.HandleFunc("/users/<id>", "GET", ok)
+
+	tag := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+				w.Header().Add("X-Chain", name)
+				next(w, req, ctx)
+			}
+		}
+	}
+	r.Use(tag("global"))
+	api.Use(tag("api"))
+
+	for path, want := range map[string]string{"/health": "global", "/api/users/1": "global,api"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if got := strings.Join(w.Header().Values("X-Chain"), ","); got != want {
+			t.Errorf("%s: expected chain %q, got %q", path, want, got)
+		}
+	}
+}
+
+func BenchmarkStaticRouteFiveMiddlewares(b *testing.B) {
+	r := NewRouter().(*Router)
+	for i := 0; i < 5; i++ {
+		r.Use(func(next HandlerFunc) HandlerFunc {
+			return func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+				next(w, req, ctx)
+			}
+		})
+	}
+	r.HandleFunc("/health", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	w := &discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
@@ -1,12 +1,59 @@
 package router
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 )
 
 type MatchFunc func(string) bool
 
+var (
+	matchersMu   sync.RWMutex
+	userMatchers = map[string]MatchFunc{}
+)
+
+func RegisterMatcher(name string, fn MatchFunc, force bool) error {
+	if name == "" || fn == nil {
+		return errors.New("router: matcher name and function are required")
+	}
+
+	matchersMu.Lock()
+	defer matchersMu.Unlock()
+
+	if !force {
+		_, isFunction := FunctionMatchers[name]
+		_, isPattern := PatternMatchers[name]
+		if isFunction || isPattern {
+			return fmt.Errorf("router: matcher %q is built in; pass force to override it", name)
+		}
+	}
+
+	userMatchers[name] = fn
+
+	return nil
+}
+
+// lookupMatcher is the only reader of the matcher maps during route
+// registration. FunctionMatchers and PatternMatchers must be treated as
+// read-only; custom matchers go through RegisterMatcher.
+func lookupMatcher(name string) (MatchFunc, bool) {
+	matchersMu.RLock()
+	defer matchersMu.RUnlock()
+
+	if fn, ok := userMatchers[name]; ok {
+		return fn, true
+	}
+	if fn, ok := PatternMatchers[name]; ok {
+		return fn, true
+	}
+	fn, ok := FunctionMatchers[name]
+	return fn, ok
+}
+
 var FunctionMatchers = map[string]MatchFunc{
 	`isLowerAlpha`: isLowerAlpha,
 	`isUpperAlpha`: isUpperAlpha,
@@ -46,6 +93,98 @@ var PatternMatchers = map[string]MatchFunc{
 	`.*`:                alwaysTrue,
 }
 
+var parametricMatchers = map[string]func(args []string) (MatchFunc, error){
+	`int`:    intRange,
+	`oneof`:  oneOf,
+	`oneofi`: oneOfFold,
+}
+
+func parseParametricMatcher(pt string) (MatchFunc, bool, error) {
+	open := strings.IndexByte(pt, '(')
+	if open <= 0 || pt[len(pt)-1] != ')' {
+		return nil, false, nil
+	}
+
+	build, ok := parametricMatchers[pt[:open]]
+	if !ok {
+		return nil, false, nil
+	}
+
+	args := strings.Split(pt[open+1:len(pt)-1], ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+
+	fn, err := build(args)
+
+	return fn, true, err
+}
+
+func intRange(args []string) (MatchFunc, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("int() expects 2 bounds, got %d", len(args))
+	}
+
+	lo, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lower bound %q", args[0])
+	}
+	hi, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upper bound %q", args[1])
+	}
+	if lo > hi {
+		return nil, fmt.Errorf("lower bound %d is greater than upper bound %d", lo, hi)
+	}
+
+	return func(s string) bool {
+		if s == "" || s[0] == '+' {
+			return false
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		return err == nil && n >= lo && n <= hi
+	}, nil
+}
+
+func oneOf(args []string) (MatchFunc, error) {
+	set, err := valueSet(args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(s string) bool {
+		_, ok := set[s]
+		return ok
+	}, nil
+}
+
+func oneOfFold(args []string) (MatchFunc, error) {
+	set, err := valueSet(args, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(s string) bool {
+		_, ok := set[strings.ToLower(s)]
+		return ok
+	}, nil
+}
+
+func valueSet(args []string, fold bool) (map[string]struct{}, error) {
+	set := make(map[string]struct{}, len(args))
+	for _, a := range args {
+		if a == "" {
+			return nil, fmt.Errorf("empty value in oneof list")
+		}
+		if fold {
+			a = strings.ToLower(a)
+		}
+		set[a] = struct{}{}
+	}
+
+	return set, nil
+}
+
 func isAny(string) bool {
 	return true
 }
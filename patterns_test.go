@@ -1,6 +1,12 @@
 package router
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
 
 func TestIsLowerAlpha(t *testing.T) {
 	ok := []string{"abc", "lowercase"}
@@ -110,3 +116,165 @@ func runMatcherTest(t *testing.T, fn MatchFunc, shouldMatch, shouldNotMatch []st
 		}
 	}
 }
+
+func isObjectID(s string) bool {
+	return len(s) == 24 && isHex(s)
+}
+
+func TestRegisterMatcher(t *testing.T) {
+	defer func() {
+		matchersMu.Lock()
+		delete(userMatchers, "isObjectID")
+		delete(userMatchers, "isDigits")
+		matchersMu.Unlock()
+	}()
+
+	if err := RegisterMatcher("isObjectID", isObjectID, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RegisterMatcher("isDigits", isAlpha, false); err == nil {
+		t.Fatalf("expected overriding a built-in matcher without force to fail")
+	}
+	if err := RegisterMatcher("isDigits", isAlpha, true); err != nil {
+		t.Fatalf("expected forced override to succeed: %v", err)
+	}
+
+	r := NewRouter().(*Router)
+	r.HandleFunc("/docs/<id:isObjectID>", "GET", handlerWithID("doc"))
+
+	req := httptest.NewRequest(http.MethodGet, "/docs/507f1f77bcf86cd799439011", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a valid object id, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/docs/not-an-id", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Fatalf("expected an invalid object id to be rejected")
+	}
+}
+
+func TestRegisterMatcherConcurrentWithRouteRegistration(t *testing.T) {
+	defer func() {
+		matchersMu.Lock()
+		for i := 0; i < 8; i++ {
+			delete(userMatchers, "isConcurrent"+strconv.Itoa(i))
+		}
+		matchersMu.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			_ = RegisterMatcher("isConcurrent"+strconv.Itoa(i), isDigits, false)
+		}(i)
+		go func() {
+			defer wg.Done()
+			r := NewRouter().(*Router)
+			r.HandleFunc("/items/<id:isDigits>/<slug:[a-z0-9\\-]+>", "GET", handlerWithID("item"))
+			if err := r.Validate(); err != nil {
+				t.Errorf("unexpected route error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, ok := lookupMatcher("isConcurrent7"); !ok {
+		t.Fatal("expected every concurrently registered matcher to be visible")
+	}
+}
+
+func TestIntRangeMatcher(t *testing.T) {
+	fn, ok, err := parseParametricMatcher("int(1,1000)")
+	if !ok || err != nil {
+		t.Fatalf("expected int(1,1000) to parse, ok=%v err=%v", ok, err)
+	}
+
+	ok1 := []string{"1", "500", "1000"}
+	fail := []string{"0", "1001", "99999999999", "abc", "", "+5", "-1", "1.5"}
+	runMatcherTest(t, fn, ok1, fail)
+
+	for _, bad := range []string{"int(1)", "int(a,b)", "int(10,1)"} {
+		if _, ok, err := parseParametricMatcher(bad); !ok || err == nil {
+			t.Errorf("expected %q to be rejected, ok=%v err=%v", bad, ok, err)
+		}
+	}
+
+	if _, ok, _ := parseParametricMatcher("[0-9]+"); ok {
+		t.Errorf("expected a plain regex not to be treated as a parametric matcher")
+	}
+}
+
+func TestIntRangeRoute(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.HandleFunc("/list/<page:int(1,1000)>", "GET", handlerWithID("page"))
+
+	req := httptest.NewRequest(http.MethodGet, "/list/42", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for page 42, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/list/99999999999", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Fatalf("expected an out-of-range page to be rejected")
+	}
+}
+
+func TestOneOfMatcher(t *testing.T) {
+	exact, ok, err := parseParametricMatcher("oneof(pdf, csv,json)")
+	if !ok || err != nil {
+		t.Fatalf("expected oneof to parse, ok=%v err=%v", ok, err)
+	}
+	runMatcherTest(t, exact, []string{"pdf", "csv", "json"}, []string{"PDF", "xml", "", "pdfx"})
+
+	fold, ok, err := parseParametricMatcher("oneofi(pdf,csv)")
+	if !ok || err != nil {
+		t.Fatalf("expected oneofi to parse, ok=%v err=%v", ok, err)
+	}
+	runMatcherTest(t, fold, []string{"pdf", "PDF", "Csv"}, []string{"json", ""})
+
+	if _, ok, err := parseParametricMatcher("oneof(pdf,,csv)"); !ok || err == nil {
+		t.Errorf("expected an empty value to be rejected, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestEscapedBracketsAreLiteral(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	r.HandleFunc(`/tags/\<raw\>`, "GET", handlerWithID("static"))
+	r.HandleFunc(`/tags/\{x\}/<id:isDigits>`, "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		id, _ := ctx.Param("id")
+		_, _ = w.Write([]byte("dynamic " + id))
+	})
+	r.HandleFunc(`/back/a\\b`, "GET", handlerWithID("backslash"))
+
+	if err := r.Validate(); err != nil {
+		t.Fatalf("unexpected registration error: %v", err)
+	}
+
+	tests := map[string]string{
+		"/tags/%3Craw%3E": "static",
+		"/tags/%7Bx%7D/5": "dynamic 5",
+		"/back/a%5Cb":     "backslash",
+	}
+	for path, want := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s: got %d %q, want 200 %q", path, w.Code, w.Body.String(), want)
+		}
+	}
+
+	if got := unescapeSegment(`a\<b\>c\d`); got != `a<b>c\d` {
+		t.Errorf("unescapeSegment = %q", got)
+	}
+}
@@ -5,6 +5,34 @@ type RadixNode struct {
 	children []*RadixNode
 	isLeaf   bool
 	entries  []RouteEntry
+	index    *methodIndex
+}
+
+// methodIndex lets a leaf dispatch by request method without scanning all of
+// its entries: methods[i] lists, in registration order, the entries serving a
+// request whose method bit is 1<<i (HEAD requests are also served by GET
+// routes).
+type methodIndex struct {
+	methods [8][]int
+}
+
+func (n *RadixNode) addEntry(entry RouteEntry) {
+	n.isLeaf = true
+	n.entries = append(n.entries, entry)
+	if n.index == nil {
+		n.index = &methodIndex{}
+	}
+
+	i := len(n.entries) - 1
+	for slot := range n.index.methods {
+		mask := 1 << slot
+		if mask == HEAD {
+			mask |= GET
+		}
+		if entry.Bitmask&mask != 0 {
+			n.index.methods[slot] = append(n.index.methods[slot], i)
+		}
+	}
 }
 
 func (r *Router) insertNode(key string, entry RouteEntry) {
@@ -46,18 +74,36 @@ func matchPrefixWithStarStr(prefix, key string) (int, bool) {
 	return j, true
 }
 
-func (r *Router) insert(node *RadixNode, key string, entry RouteEntry) {
-	for _, child := range node.children {
-		if len(child.prefix) == 0 || key[0] != child.prefix[0] {
-			continue
+// childIndex returns the position of the first child whose prefix starts at
+// or after b. Children are kept sorted by their first byte, and a radix node
+// never has two children sharing one, so a hit is the only candidate.
+func (n *RadixNode) childIndex(b byte) int {
+	lo, hi := 0, len(n.children)
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if n.children[m].prefix[0] < b {
+			lo = m + 1
+		} else {
+			hi = m
 		}
+	}
+	return lo
+}
+
+func (n *RadixNode) child(b byte) *RadixNode {
+	if i := n.childIndex(b); i < len(n.children) && n.children[i].prefix[0] == b {
+		return n.children[i]
+	}
+	return nil
+}
+
+func (r *Router) insert(node *RadixNode, key string, entry RouteEntry) {
+	i := node.childIndex(key[0])
+	if i < len(node.children) && node.children[i].prefix[0] == key[0] {
+		child := node.children[i]
 		lcp := longestCommonPrefixStr(child.prefix, key)
-		if lcp == 0 {
-			continue
-		}
 		if lcp == len(child.prefix) && lcp == len(key) {
-			child.isLeaf = true
-			child.entries = append(child.entries, entry)
+			child.addEntry(entry)
 			return
 		}
 		if lcp < len(child.prefix) {
@@ -66,65 +112,96 @@ func (r *Router) insert(node *RadixNode, key string, entry RouteEntry) {
 				children: child.children,
 				isLeaf:   child.isLeaf,
 				entries:  child.entries,
+				index:    child.index,
 			}
 			child.prefix = child.prefix[:lcp]
 			child.children = []*RadixNode{newChild}
 			child.isLeaf = false
 			child.entries = nil
+			child.index = nil
 		}
 		if lcp < len(key) {
 			r.insert(child, key[lcp:], entry)
 		} else {
-			child.isLeaf = true
-			child.entries = append(child.entries, entry)
+			child.addEntry(entry)
 		}
 		return
 	}
 
-	node.children = append(node.children, &RadixNode{prefix: key, isLeaf: true, entries: []RouteEntry{entry}})
+	leaf := &RadixNode{prefix: key}
+	leaf.addEntry(entry)
+
+	node.children = append(node.children, nil)
+	copy(node.children[i+1:], node.children[i:])
+	node.children[i] = leaf
 }
 
-func (r *Router) searchAll(key string, ctx *Context) bool {
-	return r.dfs(r.radixRoot, key, ctx)
+type searchFrame struct {
+	node *RadixNode
+	key  string
 }
 
-func (r *Router) dfs(n *RadixNode, k string, ctx *Context) bool {
-	if len(k) == 0 {
-		if n.isLeaf {
-			ctx.Entries = append(ctx.Entries, n.entries...)
-			return true
-		}
-		return false
-	}
+func (r *Router) searchAll(key string, ctx *Context) bool {
+	stack := append(ctx.search[:0], searchFrame{r.radixRoot, key})
+	ctx.leaves = ctx.leaves[:0]
 
 	found := false
 
-	k0 := k[0]
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
 
-	for _, ch := range n.children {
-		if len(ch.prefix) == 0 || ch.prefix[0] == '*' {
+		n, k := f.node, f.key
+		if len(k) == 0 {
+			if n.isLeaf {
+				ctx.leaves = append(ctx.leaves, n)
+				found = true
+			}
 			continue
 		}
-		if k0 != ch.prefix[0] {
-			continue
+
+		// The wildcard child is pushed first so the literal child pops and
+		// is explored before it.
+		if ch := n.child('*'); ch != nil {
+			if cons, ok := matchPrefixWithStarStr(ch.prefix, k); ok {
+				stack = append(stack, searchFrame{ch, k[cons:]})
+			}
 		}
-		if cons, ok := matchPrefixWithStarStr(ch.prefix, k); ok {
-			if r.dfs(ch, k[cons:], ctx) {
-				found = true
+
+		if k0 := k[0]; k0 != '*' {
+			if ch := n.child(k0); ch != nil {
+				if cons, ok := matchPrefixWithStarStr(ch.prefix, k); ok {
+					stack = append(stack, searchFrame{ch, k[cons:]})
+				}
 			}
 		}
 	}
 
-	for _, ch := range n.children {
-		if len(ch.prefix) == 0 || ch.prefix[0] != '*' {
+	ctx.search = stack[:0]
+
+	if found {
+		found = ctx.splitSegments(key)
+	}
+
+	return found
+}
+
+func (e *RouteEntry) validate(segments []Seg) bool {
+	for depth := range e.Patterns {
+		p := &e.Patterns[depth]
+
+		switch p.Type {
+		case _STRING:
 			continue
-		}
-		if cons, ok := matchPrefixWithStarStr(ch.prefix, k); ok {
-			if r.dfs(ch, k[cons:], ctx) {
-				found = true
+		case _MATCH, _SUBMATCH:
+			if !p.RegexCompiled.MatchString(segments[depth].Value) {
+				return false
+			}
+		case _PATTERN:
+			if !p.Fn(segments[depth].Value) {
+				return false
 			}
 		}
 	}
-
-	return found
+	return true
 }
@@ -13,6 +13,12 @@ func handlerWithID(id string) HandlerFunc {
 	}
 }
 
+func (c *Context) collectEntries() {
+	for _, n := range c.leaves {
+		c.Entries = append(c.Entries, n.entries...)
+	}
+}
+
 func TestLongestCommonPrefixStr(t *testing.T) {
 	tests := []struct {
 		a, b     string
@@ -89,6 +95,7 @@ func TestRadixInsertAndSearch_SimpleExact(t *testing.T) {
 	if !found {
 		t.Fatalf("expected to find /users route")
 	}
+	ctx.collectEntries()
 
 	if len(ctx.Entries) != 1 {
 		t.Fatalf("expected 1 entry, got %d", len(ctx.Entries))
@@ -120,6 +127,7 @@ func TestRadixInsertAndSearch_PrefixSplit(t *testing.T) {
 	if !r.searchAll("/users/me", ctx) {
 		t.Fatalf("expected to find /users/me")
 	}
+	ctx.collectEntries()
 
 	if len(ctx.Entries) != 1 {
 		t.Fatalf("expected 1 entry, got %d", len(ctx.Entries))
@@ -150,6 +158,7 @@ func TestRadixInsertSameKeyMultipleEntries(t *testing.T) {
 	if !r.searchAll("/same", ctx) {
 		t.Fatalf("expected to find /same")
 	}
+	ctx.collectEntries()
 
 	if len(ctx.Entries) != 2 {
 		t.Fatalf("expected 2 entries on same key, got %d", len(ctx.Entries))
@@ -172,6 +181,7 @@ func TestRadixSearchAllWithWildcard(t *testing.T) {
 	if !r.searchAll("/users/123", ctx) {
 		t.Fatalf("expected wildcard route to match")
 	}
+	ctx.collectEntries()
 
 	if len(ctx.Entries) != 1 {
 		t.Fatalf("expected 1 entry, got %d", len(ctx.Entries))
@@ -181,6 +191,62 @@ func TestRadixSearchAllWithWildcard(t *testing.T) {
 	}
 }
 
+func TestRadixSearchAllOrdersStaticBeforeWildcardAndFillsSegments(t *testing.T) {
+	r := newTestRouter()
+
+	r.insertNode("/users/*/posts", RouteEntry{Route: "/users/<id>/posts", Bitmask: GET})
+	r.insertNode("/users/me/posts", RouteEntry{Route: "/users/me/posts", Bitmask: GET})
+
+	ctx := &Context{}
+	if !r.searchAll("/users/me/posts", ctx) {
+		t.Fatalf("expected /users/me/posts to match")
+	}
+	ctx.collectEntries()
+
+	if len(ctx.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(ctx.Entries))
+	}
+	if ctx.Entries[0].Route != "/users/me/posts" || ctx.Entries[1].Route != "/users/<id>/posts" {
+		t.Errorf("expected static entry before wildcard, got %q then %q", ctx.Entries[0].Route, ctx.Entries[1].Route)
+	}
+
+	want := []string{"users", "me", "posts"}
+	if len(ctx.Segments) != len(want) {
+		t.Fatalf("expected segments %v, got %v", want, ctx.Segments)
+	}
+	for i, seg := range want {
+		if ctx.Segments[i].Value != seg {
+			t.Errorf("segment %d = %q, want %q", i, ctx.Segments[i].Value, seg)
+		}
+	}
+}
+
+func TestRadixChildrenSortedByFirstByte(t *testing.T) {
+	r := newTestRouter()
+
+	for _, key := range []string{"/z/*", "/a/*", "/*", "/m/*", "/b/*"} {
+		r.insertNode(key, RouteEntry{Route: key, Bitmask: GET})
+	}
+
+	children := r.radixRoot.children[0].children
+	for i := 1; i < len(children); i++ {
+		if children[i-1].prefix[0] >= children[i].prefix[0] {
+			t.Fatalf("children not sorted: %q before %q", children[i-1].prefix, children[i].prefix)
+		}
+	}
+
+	for _, path := range []string{"/z/1", "/a/1", "/m/1", "/b/1"} {
+		ctx := &Context{}
+		if !r.searchAll(path, ctx) {
+			t.Fatalf("expected %s to match", path)
+		}
+		ctx.collectEntries()
+		if want := path[:3] + "*"; ctx.Entries[0].Route != want {
+			t.Errorf("%s: first entry %q, want %q", path, ctx.Entries[0].Route, want)
+		}
+	}
+}
+
 func TestRadixSearchAll_NoMatch(t *testing.T) {
 	r := newTestRouter()
 
@@ -195,6 +261,7 @@ func TestRadixSearchAll_NoMatch(t *testing.T) {
 	if r.searchAll("/bar", ctx) {
 		t.Fatalf("expected no match for /bar")
 	}
+	ctx.collectEntries()
 	if len(ctx.Entries) != 0 {
 		t.Fatalf("expected 0 entries, got %d", len(ctx.Entries))
 	}
@@ -217,3 +284,124 @@ func TestRadixSearchIntegrationThroughHandleFunc(t *testing.T) {
 		t.Fatalf("unexpected body: %q", body)
 	}
 }
+
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d *discardResponseWriter) Header() http.Header         { return d.header }
+func (d *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardResponseWriter) WriteHeader(int)             {}
+
+func BenchmarkDynamicRouteFiveSegments(b *testing.B) {
+	r := NewRouter().(*Router)
+	r.HandleFunc("/api/users/<id:isDigits>/posts/<post:isDigits>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {})
+	r.HandleFunc("/api/users/<id:isDigits>/comments/<comment:isDigits>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {})
+	r.HandleFunc("/api/teams/<id:isDigits>/posts/<post:isDigits>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/42/posts/7", nil)
+	w := &discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
+
+func TestStaticRoutesAreNotInsertedIntoRadix(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.HandleFunc("/health", "GET", handlerWithID("health"))
+	r.HandleFunc("/api/v1/users", "GET", handlerWithID("users"))
+	r.HandleFunc("/api/v1/users/<id:isDigits>", "GET", handlerWithID("user"))
+
+	if _, ok := r.staticRoutes["/api/v1/users"]; !ok {
+		t.Fatalf("expected static route in the static map")
+	}
+
+	ctx := &Context{}
+	if r.searchAll("/api/v1/users", ctx) || r.searchAll("/health", ctx) {
+		t.Errorf("expected static routes to live only in the static map")
+	}
+	if !r.searchAll("/api/v1/users/7", ctx) {
+		t.Errorf("expected dynamic route in the radix tree")
+	}
+}
+
+func BenchmarkWideRadixNode(b *testing.B) {
+	const names = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	r := NewRouter().(*Router)
+	for i := 0; i < len(names); i++ {
+		r.HandleFunc("/api/"+names[i:i+1]+"resource/<id:isDigits>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {})
+	}
+
+	ctx := &Context{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx.Entries = ctx.Entries[:0]
+		ctx.Segments = ctx.Segments[:0]
+		if !r.searchAll("/api/9resource/42", ctx) {
+			b.Fatal("expected a match")
+		}
+	}
+}
+
+func TestLeafDispatchesByMethod(t *testing.T) {
+	r := NewRouter().(*Router)
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+		r.HandleFunc("/users/<id:isDigits>", method, handlerWithID(method))
+	}
+	r.HandleFunc("/users/<name:isAlpha>", "GET", handlerWithID("GET by name"))
+	r.HandleFunc("/users/<any>", "PATCH, GET", handlerWithID("PATCH or GET"))
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/users/7", http.StatusOK, "GET"},
+		{http.MethodPost, "/users/7", http.StatusOK, "POST"},
+		{http.MethodPut, "/users/7", http.StatusOK, "PUT"},
+		{http.MethodDelete, "/users/7", http.StatusOK, "DELETE"},
+		{http.MethodHead, "/users/7", http.StatusOK, ""},
+		{http.MethodGet, "/users/ada", http.StatusOK, "GET by name"},
+		{http.MethodGet, "/users/ada-1", http.StatusOK, "PATCH or GET"},
+		{http.MethodPatch, "/users/7", http.StatusOK, "PATCH or GET"},
+		{http.MethodPost, "/users/ada", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+
+		if w.Code != tc.status || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("%s %s: got %d %q, want %d %q", tc.method, tc.path, w.Code, w.Body.String(), tc.status, tc.body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/users/7", nil))
+	if got := w.Header().Get("Allow"); got != "GET, HEAD, POST, PUT, DELETE, PATCH, OPTIONS" {
+		t.Errorf("unexpected Allow header %q", got)
+	}
+}
+
+func BenchmarkDynamicRouteAllVerbs(b *testing.B) {
+	r := NewRouter().(*Router)
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		r.HandleFunc("/api/users/<id:isDigits>", method, func(w http.ResponseWriter, req *http.Request, ctx *Context) {})
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/users/42", nil)
+	w := &discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
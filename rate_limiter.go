@@ -1,39 +1,85 @@
 package router
 
 import (
+	"math"
 	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type RequestCounter struct {
 	lastRequest sync.Map
+	requests    atomic.Uint64
+	blocked     atomic.Uint64
+	keys        atomic.Int64
+}
+
+type RateLimiterStats struct {
+	Requests    uint64
+	Blocked     uint64
+	TrackedKeys int64
+}
+
+func RateLimitStats() RateLimiterStats {
+	c := requestCounter
+	return RateLimiterStats{
+		Requests:    c.requests.Load(),
+		Blocked:     c.blocked.Load(),
+		TrackedKeys: c.keys.Load(),
+	}
 }
 
-var trustedCIDRs []*net.IPNet
 var requestCounter = &RequestCounter{}
 
-func SetTrustedProxies(cidrs []string) {
-	trustedCIDRs = trustedCIDRs[:0]
+type ClientIPExtractor func(*http.Request) string
+
+type clientIPPolicy struct {
+	extractor ClientIPExtractor
+	trusted   []netip.Prefix
+	hops      int
+}
+
+func (r *Router) SetTrustedProxies(cidrs []string) {
+	r.mustNotBeSealed("SetTrustedProxies")
+
+	trusted := make([]netip.Prefix, 0, len(cidrs))
 	for _, c := range cidrs {
-		if _, ipn, err := net.ParseCIDR(c); err == nil {
-			trustedCIDRs = append(trustedCIDRs, ipn)
+		if p, err := netip.ParsePrefix(strings.TrimSpace(c)); err == nil {
+			trusted = append(trusted, p.Masked())
 		}
 	}
+	r.clientIPs.trusted = trusted
 }
 
-func isTrustedRemote(remoteAddr string) bool {
-	host, _, err := net.SplitHostPort(remoteAddr)
-	if err != nil {
-		host = remoteAddr
+func (r *Router) SetTrustedHops(hops int) {
+	r.mustNotBeSealed("SetTrustedHops")
+
+	if hops < 0 {
+		hops = 0
 	}
-	ip := net.ParseIP(host)
-	if ip == nil {
+	r.clientIPs.hops = hops
+}
+
+func (r *Router) SetClientIPExtractor(fn ClientIPExtractor) {
+	r.mustNotBeSealed("SetClientIPExtractor")
+	r.clientIPs.extractor = fn
+}
+
+func (r *Router) clientIP(req *http.Request) string {
+	return r.clientIPs.clientIP(req)
+}
+
+func (p *clientIPPolicy) isTrusted(remoteAddr string) bool {
+	ip, ok := parseIPAddr(remoteAddr)
+	if !ok {
 		return false
 	}
-	for _, n := range trustedCIDRs {
+	for _, n := range p.trusted {
 		if n.Contains(ip) {
 			return true
 		}
@@ -41,6 +87,36 @@ func isTrustedRemote(remoteAddr string) bool {
 	return false
 }
 
+func parseIPAddr(s string) (netip.Addr, bool) {
+	s = fastTrimSpace(s)
+	if s == "" {
+		return netip.Addr{}, false
+	}
+
+	if s[0] == '[' {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return netip.Addr{}, false
+		}
+		s = s[1:end]
+	} else if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().WithZone("").Unmap(), true
+	}
+
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.WithZone("").Unmap(), true
+}
+
+func normalizeIP(s string) string {
+	if ip, ok := parseIPAddr(s); ok {
+		return ip.String()
+	}
+	return fastTrimSpace(s)
+}
+
 func fastTrimSpace(s string) string {
 	start := 0
 	end := len(s)
@@ -64,33 +140,59 @@ func fastTrimSpace(s string) string {
 	return s[start:end]
 }
 
-func firstCommaPart(s string) string {
-	for i := 0; i < len(s); i++ {
-		if s[i] == ',' {
-			return s[:i]
+func (p *clientIPPolicy) clientIP(r *http.Request) string {
+	if p.extractor != nil {
+		return p.extractor(r)
+	}
+
+	if p.isTrusted(r.RemoteAddr) {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			if ip := p.forwardedClientIP(strings.Join(xff, ",")); ip != "" {
+				return ip
+			}
+		}
+		if xrip := r.Header.Get("X-Real-IP"); xrip != "" {
+			return normalizeIP(xrip)
 		}
 	}
-	return s
+	return peerIP(r)
 }
 
-func clientIP(r *http.Request) string {
-	if isTrustedRemote(r.RemoteAddr) {
-		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-			return fastTrimSpace(firstCommaPart(xff))
+func (p *clientIPPolicy) forwardedClientIP(xff string) string {
+	parts := strings.Split(xff, ",")
+
+	leftmost := ""
+	for i := len(parts) - 1; i >= 0; i-- {
+		ip := normalizeIP(parts[i])
+		if ip == "" {
+			continue
 		}
-		if xrip := r.Header.Get("X-Real-IP"); xrip != "" {
-			return fastTrimSpace(xrip)
+		leftmost = ip
+
+		if p.hops > 0 {
+			if len(parts)-i == p.hops {
+				return ip
+			}
+			continue
+		}
+
+		if !p.isTrusted(ip) {
+			return ip
 		}
 	}
+	return leftmost
+}
+
+func peerIP(r *http.Request) string {
 	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil && host != "" {
-		return host
+		return normalizeIP(host)
 	}
-	return r.RemoteAddr
+	return normalizeIP(r.RemoteAddr)
 }
 
 func makeKey(r *http.Request) string {
 	var b strings.Builder
-	ip := clientIP(r)
+	ip := peerIP(r)
 	path := r.URL.Path
 
 	b.Grow(len(r.Method) + 1 + len(ip) + 1 + len(path))
@@ -106,33 +208,198 @@ func Abort(ctx *Context) {
 	ctx.Abort()
 }
 
+type LimitedHandler func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration)
+
+type RateLimiterStore interface {
+	Allow(key string, now time.Time) (bool, time.Duration)
+}
+
+type RateLimitOptions struct {
+	RetryAfter time.Duration
+	OnLimited  LimitedHandler
+	Store      RateLimiterStore
+}
+
 func RateLimit(w http.ResponseWriter, r *http.Request, threshold time.Duration) bool {
+	return RateLimitWithOptions(w, r, threshold, RateLimitOptions{RetryAfter: time.Second})
+}
+
+func RateLimitWithOptions(w http.ResponseWriter, r *http.Request, threshold time.Duration, opts RateLimitOptions) bool {
 	now := time.Now()
 	key := makeKey(r)
+	requestCounter.requests.Add(1)
 
-	if v, ok := requestCounter.lastRequest.Load(key); ok {
-		if last, ok := v.(time.Time); ok && now.Sub(last) < threshold {
-			w.Header().Set("Retry-After", "1")
-			JSON(w, http.StatusTooManyRequests, Msg{
-				Title: "too_many_requests", Message: "Please slow down.", StatusCode: http.StatusTooManyRequests,
-			})
+	var allowed bool
+	var wait time.Duration
+	if opts.Store != nil {
+		allowed, wait = opts.Store.Allow(key, now)
+	} else {
+		allowed, wait = requestCounter.allow(key, now, threshold)
+	}
 
-			return true
+	if allowed {
+		return false
+	}
+
+	requestCounter.blocked.Add(1)
+	if opts.RetryAfter > 0 {
+		wait = opts.RetryAfter
+	}
+	respondLimited(opts.OnLimited, w, r, wait)
+	return true
+}
+
+func (c *RequestCounter) allow(key string, now time.Time, threshold time.Duration) (bool, time.Duration) {
+	if v, ok := c.lastRequest.Load(key); ok {
+		if last, ok := v.(time.Time); ok && now.Sub(last) < threshold {
+			return false, threshold - now.Sub(last)
 		}
 	}
 
-	requestCounter.lastRequest.Store(key, now)
+	if _, loaded := c.lastRequest.Swap(key, now); !loaded {
+		c.keys.Add(1)
+	}
 	cleanupOldRequests(now, threshold*2)
 
-	return false
+	return true, 0
 }
 
 func cleanupOldRequests(now time.Time, ttl time.Duration) {
 	cutoff := now.Add(-ttl)
 	requestCounter.lastRequest.Range(func(k, v any) bool {
-		if t, ok := v.(time.Time); ok && t.Before(cutoff) {
-			requestCounter.lastRequest.Delete(k)
+		if t, ok := v.(time.Time); ok && t.Before(cutoff) && requestCounter.lastRequest.CompareAndDelete(k, v) {
+			requestCounter.keys.Add(-1)
 		}
 		return true
 	})
 }
+
+func respondLimited(fn LimitedHandler, w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	if fn == nil {
+		writeTooManyRequests(w, retryAfter)
+		return
+	}
+	w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	fn(w, r, retryAfter)
+}
+
+func retryAfterSeconds(retryAfter time.Duration) string {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	JSON(w, http.StatusTooManyRequests, Msg{
+		Title: "too_many_requests", Message: "Please slow down.", StatusCode: http.StatusTooManyRequests,
+	})
+}
+
+type RateConfig struct {
+	Requests  int
+	Per       time.Duration
+	Burst     int
+	OnLimited LimitedHandler
+	Store     RateLimiterStore
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+type routeLimiter struct {
+	rate      float64
+	burst     float64
+	idleTTL   time.Duration
+	buckets   sync.Map
+	lastSweep atomic.Int64
+}
+
+func NewMemoryRateLimiter(cfg RateConfig) RateLimiterStore {
+	return newRouteLimiter(cfg)
+}
+
+func newRouteLimiter(cfg RateConfig) *routeLimiter {
+	if cfg.Requests <= 0 {
+		cfg.Requests = 1
+	}
+	if cfg.Per <= 0 {
+		cfg.Per = time.Second
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = cfg.Requests
+	}
+
+	rate := float64(cfg.Requests) / cfg.Per.Seconds()
+
+	return &routeLimiter{
+		rate:    rate,
+		burst:   float64(cfg.Burst),
+		idleTTL: time.Duration(float64(cfg.Burst) / rate * float64(time.Second)),
+	}
+}
+
+func (l *routeLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	v, _ := l.buckets.LoadOrStore(key, &tokenBucket{tokens: l.burst, last: now})
+	b := v.(*tokenBucket)
+
+	b.mu.Lock()
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.mu.Unlock()
+		l.sweep(now)
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	return false, wait
+}
+
+func (l *routeLimiter) sweep(now time.Time) {
+	last := l.lastSweep.Load()
+	if now.UnixNano()-last < int64(l.idleTTL) || !l.lastSweep.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	cutoff := now.Add(-l.idleTTL)
+	l.buckets.Range(func(k, v any) bool {
+		b := v.(*tokenBucket)
+		b.mu.Lock()
+		idle := b.last.Before(cutoff)
+		b.mu.Unlock()
+		if idle {
+			l.buckets.Delete(k)
+		}
+		return true
+	})
+}
+
+func (r *Router) HandleFuncRateLimit(url string, methods string, limit RateConfig, fn HandlerFunc) {
+	limiter := limit.Store
+	if limiter == nil {
+		limiter = newRouteLimiter(limit)
+	}
+
+	r.HandleFunc(url, methods, func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		if ok, wait := limiter.Allow(r.clientIP(req), time.Now()); !ok {
+			respondLimited(limit.OnLimited, w, req, wait)
+			ctx.Abort()
+			return
+		}
+
+		fn(w, req, ctx)
+	})
+}
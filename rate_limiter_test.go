@@ -3,6 +3,7 @@ package router
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -81,3 +82,246 @@ func TestCleanupOldRequests(t *testing.T) {
 		t.Errorf("expected old key to be cleaned")
 	}
 }
+
+func TestRateLimitStats(t *testing.T) {
+	resetRequestCounter()
+
+	threshold := time.Minute
+	for _, ip := range []string{"10.0.0.1:1", "10.0.0.1:2", "10.0.0.2:1", "10.0.0.1:3"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip
+		RateLimit(httptest.NewRecorder(), req, threshold)
+	}
+
+	stats := RateLimitStats()
+	if stats.Requests != 4 || stats.Blocked != 2 || stats.TrackedKeys != 2 {
+		t.Fatalf("unexpected stats after traffic: %+v", stats)
+	}
+
+	cleanupOldRequests(time.Now().Add(time.Hour), threshold)
+
+	if stats := RateLimitStats(); stats.TrackedKeys != 0 || stats.Requests != 4 {
+		t.Fatalf("expected tracked keys to drop after cleanup, got %+v", stats)
+	}
+}
+
+func TestRateLimitWithOptions_CustomResponse(t *testing.T) {
+	resetRequestCounter()
+
+	opts := RateLimitOptions{
+		OnLimited: func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+			Text(w, http.StatusServiceUnavailable, "busy, retry in "+retryAfter.Round(time.Minute).String())
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+
+	RateLimitWithOptions(httptest.NewRecorder(), req, 10*time.Minute, opts)
+
+	w := httptest.NewRecorder()
+	if !RateLimitWithOptions(w, req, 10*time.Minute, opts) {
+		t.Fatal("expected the second request to be limited")
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "busy, retry in 10m0s" {
+		t.Fatalf("unexpected custom response: %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got != "600" {
+		t.Fatalf("expected Retry-After derived from the threshold, got %q", got)
+	}
+}
+
+func TestRateLimit_DefaultResponseUnchanged(t *testing.T) {
+	resetRequestCounter()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+
+	RateLimit(httptest.NewRecorder(), req, 10*time.Minute)
+	w := httptest.NewRecorder()
+	RateLimit(w, req, 10*time.Minute)
+
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Fatalf("expected Retry-After 1, got %q", got)
+	}
+	if !strings.Contains(w.Body.String(), "Please slow down.") {
+		t.Fatalf("expected the default JSON body, got %q", w.Body.String())
+	}
+}
+
+func TestHandleFuncRateLimit_OnLimited(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	limit := RateConfig{Requests: 1, Per: time.Minute, OnLimited: func(w http.ResponseWriter, req *http.Request, retryAfter time.Duration) {
+		JSON(w, http.StatusTooManyRequests, map[string]string{"error": "rate_limited"})
+	}}
+	r.HandleFuncRateLimit("/login", "POST", limit, handlerWithID("login"))
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+	}
+
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), `"rate_limited"`) {
+		t.Fatalf("unexpected limited response: %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After to be set for custom responses")
+	}
+}
+
+type fixedWindowStore struct {
+	limit int
+	seen  map[string]int
+	keys  []string
+}
+
+func (s *fixedWindowStore) Allow(key string, now time.Time) (bool, time.Duration) {
+	s.keys = append(s.keys, key)
+	s.seen[key]++
+	if s.seen[key] > s.limit {
+		return false, 30 * time.Second
+	}
+	return true, 0
+}
+
+func TestRateLimitCallsThroughStore(t *testing.T) {
+	resetRequestCounter()
+
+	store := &fixedWindowStore{limit: 2, seen: map[string]int{}}
+	opts := RateLimitOptions{Store: store}
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.RemoteAddr = "10.0.0.9:1234"
+
+	var limited bool
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		w = httptest.NewRecorder()
+		limited = RateLimitWithOptions(w, req, time.Nanosecond, opts)
+	}
+
+	if !limited || w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the store to limit the third request, got limited=%v status=%d", limited, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Fatalf("expected Retry-After from the store, got %q", got)
+	}
+	if len(store.keys) != 3 || store.keys[0] != "GET|10.0.0.9|/api" {
+		t.Fatalf("unexpected keys passed to the store: %v", store.keys)
+	}
+	if stats := RateLimitStats(); stats.Requests != 3 || stats.Blocked != 1 {
+		t.Fatalf("expected stats to count store decisions, got %+v", stats)
+	}
+}
+
+func TestHandleFuncRateLimit_SharedStore(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	store := NewMemoryRateLimiter(RateConfig{Requests: 1, Per: time.Minute})
+	r.HandleFuncRateLimit("/login", "POST", RateConfig{Store: store}, handlerWithID("login"))
+	r.HandleFuncRateLimit("/reset", "POST", RateConfig{Store: store}, handlerWithID("reset"))
+
+	codes := make([]int, 0, 2)
+	for _, path := range []string{"/login", "/reset"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("expected the shared store to limit across routes, got %v", codes)
+	}
+}
+
+func TestHandleFuncRateLimit_LimitsOnlyThatRoute(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	r.HandleFuncRateLimit("/login", "POST", RateConfig{Requests: 2, Per: time.Minute}, handlerWithID("login"))
+	r.HandleFunc("/products", "GET", handlerWithID("products"))
+
+	do := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.1.1.1:5000"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := do(http.MethodPost, "/login"); code != http.StatusOK {
+			t.Fatalf("login attempt %d: expected 200, got %d", i+1, code)
+		}
+	}
+
+	if code := do(http.MethodPost, "/login"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected third login attempt to be limited, got %d", code)
+	}
+
+	for i := 0; i < 5; i++ {
+		if code := do(http.MethodGet, "/products"); code != http.StatusOK {
+			t.Fatalf("products request %d: expected 200, got %d", i+1, code)
+		}
+	}
+}
+
+func TestRouteLimiterRefills(t *testing.T) {
+	l := newRouteLimiter(RateConfig{Requests: 1, Per: time.Second})
+	now := time.Now()
+
+	if ok, _ := l.Allow("k", now); !ok {
+		t.Fatalf("expected first request to pass")
+	}
+	ok, wait := l.Allow("k", now)
+	if ok || wait <= 0 {
+		t.Fatalf("expected second request to be limited with a wait, got ok=%v wait=%v", ok, wait)
+	}
+	if ok, _ := l.Allow("k", now.Add(time.Second)); !ok {
+		t.Fatalf("expected bucket to refill after one second")
+	}
+}
+
+func TestClientIPExtractorUsedEverywhere(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.SetClientIPExtractor(func(req *http.Request) string {
+		return req.Header.Get("Fastly-Client-IP")
+	})
+	r.HandleFuncRateLimit("/login", "GET", RateConfig{Requests: 1, Per: time.Minute}, func(w http.ResponseWriter, req *http.Request, ctx *Context) {})
+
+	newReq := func(remote string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/login", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("Fastly-Client-IP", "198.51.100.7")
+		req.Header.Set("X-Real-IP", "10.9.9.9")
+		return req
+	}
+
+	var realIP string
+	RealIP()(func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		realIP = GetRealIP(req)
+	})(httptest.NewRecorder(), newReq("192.0.2.1:1234"), &Context{router: r})
+	if realIP != "198.51.100.7" {
+		t.Fatalf("RealIP = %q, want %q", realIP, "198.51.100.7")
+	}
+
+	if got := r.clientIP(newReq("192.0.2.1:1234")); got != "198.51.100.7" {
+		t.Fatalf("request log IP = %q, want %q", got, "198.51.100.7")
+	}
+
+	w1 := httptest.NewRecorder()
+	r.ServeHTTP(w1, newReq("192.0.2.1:1234"))
+	w2 := httptest.NewRecorder()
+	r.ServeHTTP(w2, newReq("192.0.2.2:5678"))
+	if w1.Code != http.StatusOK || w2.Code != http.StatusTooManyRequests {
+		t.Fatalf("rate limiter should key on extracted IP, got %d then %d", w1.Code, w2.Code)
+	}
+
+	if got := NewRouter().(*Router).clientIP(newReq("192.0.2.1:1234")); got != "192.0.2.1" {
+		t.Fatalf("another router's clientIP = %q, want %q", got, "192.0.2.1")
+	}
+}
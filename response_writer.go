@@ -0,0 +1,209 @@
+package router
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+
+	views [8]http.ResponseWriter
+}
+
+func (sr *statusRecorder) reset(w http.ResponseWriter) {
+	sr.ResponseWriter = w
+	sr.status = 0
+	sr.written = 0
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.written += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps the sendfile path of the wrapped writer available to
+// io.Copy, http.ServeContent and the static file server.
+func (sr *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+
+	var n int64
+	var err error
+	if rf, ok := sr.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(sr.ResponseWriter, src)
+	}
+	sr.written += n
+	return n, err
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+const (
+	canFlush = 1 << iota
+	canHijack
+	canPush
+)
+
+// view returns the recorder as a writer that implements http.Flusher,
+// http.Hijacker and http.Pusher only when the wrapped writer does, so
+// capability checks in handlers keep telling the truth.
+func (sr *statusRecorder) view() http.ResponseWriter {
+	var caps int
+	if _, ok := sr.ResponseWriter.(http.Flusher); ok {
+		caps |= canFlush
+	}
+	if _, ok := sr.ResponseWriter.(http.Hijacker); ok {
+		caps |= canHijack
+	}
+	if _, ok := sr.ResponseWriter.(http.Pusher); ok {
+		caps |= canPush
+	}
+
+	if v := sr.views[caps]; v != nil {
+		return v
+	}
+
+	f, h, p := recorderFlusher{sr}, recorderHijacker{sr}, recorderPusher{sr}
+
+	var v http.ResponseWriter
+	switch caps {
+	case 0:
+		v = sr
+	case canFlush:
+		v = &struct {
+			*statusRecorder
+			recorderFlusher
+		}{sr, f}
+	case canHijack:
+		v = &struct {
+			*statusRecorder
+			recorderHijacker
+		}{sr, h}
+	case canFlush | canHijack:
+		v = &struct {
+			*statusRecorder
+			recorderFlusher
+			recorderHijacker
+		}{sr, f, h}
+	case canPush:
+		v = &struct {
+			*statusRecorder
+			recorderPusher
+		}{sr, p}
+	case canFlush | canPush:
+		v = &struct {
+			*statusRecorder
+			recorderFlusher
+			recorderPusher
+		}{sr, f, p}
+	case canHijack | canPush:
+		v = &struct {
+			*statusRecorder
+			recorderHijacker
+			recorderPusher
+		}{sr, h, p}
+	default:
+		v = &struct {
+			*statusRecorder
+			recorderFlusher
+			recorderHijacker
+			recorderPusher
+		}{sr, f, h, p}
+	}
+
+	sr.views[caps] = v
+	return v
+}
+
+type recorderFlusher struct{ sr *statusRecorder }
+
+func (f recorderFlusher) Flush() {
+	if f.sr.status == 0 {
+		f.sr.status = http.StatusOK
+	}
+	f.sr.ResponseWriter.(http.Flusher).Flush()
+}
+
+type recorderHijacker struct{ sr *statusRecorder }
+
+func (h recorderHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.sr.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+type recorderPusher struct{ sr *statusRecorder }
+
+func (p recorderPusher) Push(target string, opts *http.PushOptions) error {
+	return p.sr.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+type headWriter struct {
+	http.ResponseWriter
+	status      int
+	length      int64
+	wroteHeader bool
+}
+
+func (hw *headWriter) WriteHeader(status int) {
+	if hw.status == 0 {
+		hw.status = status
+	}
+}
+
+func (hw *headWriter) Write(b []byte) (int, error) {
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	hw.length += int64(len(b))
+	return len(b), nil
+}
+
+func (hw *headWriter) Flush() {
+	hw.finish()
+	if fl, ok := hw.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+func (hw *headWriter) finish() {
+	if hw.wroteHeader {
+		return
+	}
+	hw.wroteHeader = true
+
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+
+	h := hw.ResponseWriter.Header()
+	if hw.length > 0 && h.Get("Content-Length") == "" && h.Get("Transfer-Encoding") == "" {
+		h.Set("Content-Length", strconv.FormatInt(hw.length, 10))
+	}
+
+	hw.ResponseWriter.WriteHeader(hw.status)
+}
+
+func (hw *headWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
@@ -0,0 +1,11 @@
+//go:build !unix || solaris
+
+package router
+
+import "net"
+
+const reusePortSupported = false
+
+func reusePortListenConfig() net.ListenConfig {
+	return net.ListenConfig{}
+}
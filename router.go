@@ -2,19 +2,24 @@ package router
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
-	"golang.org/x/sys/unix"
 	"log"
+	"log/slog"
+	"math/bits"
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"net/url"
 	"os"
 	"os/signal"
 	"regexp"
 	"regexp/syntax"
 	"runtime"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,33 +30,95 @@ import (
 
 type HandlerFunc func(http.ResponseWriter, *http.Request, *Context)
 
+var (
+	ErrInvalidMethod = errors.New("router: invalid HTTP method")
+	ErrEmptyPattern  = errors.New("router: empty route pattern")
+)
+
+type RouteError struct {
+	Route   string
+	Segment string
+	Err     error
+}
+
+func (e *RouteError) Error() string {
+	return fmt.Sprintf("router: route %q, segment %q: %v", e.Route, e.Segment, e.Err)
+}
+
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
 type IRouter interface {
 	MultiListenAndServe(listeners Listeners)
+	MultiListenAndServeErr(listeners Listeners) error
+	Serve(ctx context.Context, listeners Listeners) error
 	ListenAndServe(port int)
+	ListenAndServeErr(port int) error
 	HandleFunc(url string, methods string, fn HandlerFunc)
+	HandleFuncMeta(url string, methods string, meta RouteMeta, fn HandlerFunc)
+	HandleFuncErr(url string, methods string, fn HandlerFunc) error
+	GET(url string, fn HandlerFunc)
+	POST(url string, fn HandlerFunc)
+	PUT(url string, fn HandlerFunc)
+	DELETE(url string, fn HandlerFunc)
+	PATCH(url string, fn HandlerFunc)
+	ToHTTP(fn HandlerFunc) http.HandlerFunc
+	HandleFuncMulti(paths []string, methods string, fn HandlerFunc)
+	HandleFuncRateLimit(url string, methods string, limit RateConfig, fn HandlerFunc)
 	Prefix(segment string)
 	Use(m Middleware)
+	PreRoute(fn func(w http.ResponseWriter, req *http.Request) bool)
 	Recovery(fn HandlerFunc)
+	OnPanic(fn func(req *http.Request, recovered any, stack []byte))
 	Static(dir string, replace string)
+	StaticWithOptions(dir string, replace string, opts StaticOptions)
+	StaticWithCache(dir string, replace string, maxAge time.Duration)
+	StaticPrecedence(order StaticPrecedence)
+	StaticMounts() []string
+	File(route string, filepath string)
 	EnableProfiling(EnableProfiling string)
 	TerminalOutput(terminalOutput bool)
+	RawPathParams(raw bool)
+	RejectDotSegments(reject bool)
 	NotFound(fn HandlerFunc)
+	Fallback(prefix string, fn HandlerFunc)
+	NotFoundBody(body []byte, contentType string)
+	NotFoundJSON()
 	Ready()
+	Health(path string, checks ...HealthCheck)
+	SetLogger(l Logger)
+	SetErrorLogger(l *slog.Logger)
+	VerboseStackTraces(verbose bool)
 	Group(prefix string) *RouteGroup
+	PreShutdownDelay(d time.Duration)
+	SetTrustedProxies(cidrs []string)
+	SetTrustedHops(hops int)
+	SetClientIPExtractor(fn ClientIPExtractor)
+	Workers(n int)
+	TuneRuntime(tune bool)
+	ConnStats() ConnStats
+	Validate() error
 }
 
 const serverName = `NetLifeGuru`
 const serverVersion = `v1.0.8`
+const shutdownTimeout = 5 * time.Second
 
 type RouteGroup struct {
-	r      *Router
-	prefix string
+	r           *Router
+	prefix      string
+	contentType string
 }
 
 type Listener struct {
-	Listen string
-	Domain string
-	Encode string
+	Listen    string
+	Domain    string
+	Encode    string
+	CertFile  string
+	KeyFile   string
+	ClientCAs *x509.CertPool
+	Handler   http.Handler
 }
 
 type Listeners []Listener
@@ -74,17 +141,45 @@ type StaticSegments struct {
 
 var notFound = []byte("404 page not found")
 
+var notFoundJSON = []byte(`{"error":"not found","status":404}`)
+
 type StaticMap map[string]http.Handler
 
+type StaticPrecedence int
+
+const (
+	StaticFirst StaticPrecedence = iota
+	RoutesFirst
+)
+
+type RouteMeta struct {
+	CORS        *CORSOptions
+	ContentType string
+}
+
 type RouteEntry struct {
 	Route      string
 	Patterns   []Pattern
 	Handler    HandlerFunc
 	Bitmask    int
 	Validation bool
+	Meta       RouteMeta
+
+	wrapped HandlerFunc
+}
+
+type StaticRoutes map[string][]RouteEntry
+
+type fallbackRoute struct {
+	prefix  string
+	handler HandlerFunc
+	wrapped HandlerFunc
 }
 
-type StaticRoutes map[string]RouteEntry
+type adaptedHandler struct {
+	handler HandlerFunc
+	wrapped HandlerFunc
+}
 
 type GroupMiddleware struct {
 	Route string
@@ -94,17 +189,39 @@ type GroupMiddleware struct {
 type GroupMiddlewares map[string]GroupMiddleware
 
 type Router struct {
-	radixRoot        *RadixNode
-	staticRoutes     StaticRoutes
-	groupMiddlewares GroupMiddlewares
-	mux              *http.ServeMux
-	recovery         HandlerFunc
-	notFound         HandlerFunc
-	terminalOutput   bool
-	prefixSegment    string
-	staticFiles      StaticMap
-	ready            atomic.Bool
-	middlewares      map[string][]Middleware
+	radixRoot         *RadixNode
+	staticRoutes      StaticRoutes
+	groupMiddlewares  GroupMiddlewares
+	mux               *http.ServeMux
+	recovery          HandlerFunc
+	onPanic           func(req *http.Request, recovered any, stack []byte)
+	notFound          HandlerFunc
+	fallbacks         []fallbackRoute
+	adapted           []*adaptedHandler
+	notFoundBody      []byte
+	notFoundType      string
+	terminalOutput    bool
+	rawPathParams     bool
+	rejectDotSegments bool
+	prefixSegment     string
+	staticFiles       StaticMap
+	staticDirs        map[string]http.FileSystem
+	staticOrder       StaticPrecedence
+	ready             atomic.Bool
+	sealed            atomic.Bool
+	middlewares       map[string][]Middleware
+	preShutdownDelay  time.Duration
+	workers           int
+	keepRuntime       bool
+	logger            Logger
+	errorLogger       *slog.Logger
+	verboseStacks     bool
+	regexCache        map[string]*regexp.Regexp
+	shutdownDeadline  atomic.Pointer[time.Time]
+	conns             connTracker
+	routeErrors       []error
+	preRoute          []func(http.ResponseWriter, *http.Request) bool
+	clientIPs         clientIPPolicy
 }
 
 func NewRouter() IRouter {
@@ -119,6 +236,8 @@ func NewRouter() IRouter {
 		terminalOutput:   false,
 		prefixSegment:    "",
 		staticFiles:      make(StaticMap),
+		staticDirs:       make(map[string]http.FileSystem),
+		logger:           defaultLogger,
 	}
 
 	r.ready.Store(true)
@@ -134,6 +253,25 @@ func (r *Router) IsReady() bool {
 	return r.ready.Load()
 }
 
+func (r *Router) markShutdown(deadline time.Time) {
+	r.SetReady(false)
+	r.shutdownDeadline.Store(&deadline)
+}
+
+func (r *Router) ShutdownDeadline() (time.Time, bool) {
+	if d := r.shutdownDeadline.Load(); d != nil {
+		return *d, true
+	}
+	return time.Time{}, false
+}
+
+func (r *Router) PreShutdownDelay(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	r.preShutdownDelay = d
+}
+
 type contextKey string
 
 const (
@@ -158,18 +296,36 @@ func (r *Router) removeWrapper(s string, start string, end string) string {
 func (r *Router) findPatterns(str string) MatchFunc {
 	possibleRegExpPattern := r.removeWrapper(str, "(", ")")
 
-	if pattern, ok := PatternMatchers[possibleRegExpPattern]; ok {
-		// function
-		return pattern
-	} else if pattern, ok := FunctionMatchers[possibleRegExpPattern]; ok {
-		// function
+	if pattern, ok := lookupMatcher(possibleRegExpPattern); ok {
 		return pattern
 	}
 
 	return nil
 }
 
-func (r *Router) parseSlug(isStatic, reqValidation bool, s, url string) (Pattern, bool, bool) {
+func (r *Router) compileRegex(pt string) (*regexp.Regexp, error) {
+	if re, ok := r.regexCache[pt]; ok {
+		return re, nil
+	}
+
+	if _, err := syntax.Parse(pt, syntax.PerlX); err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile("^(?:" + pt + ")$")
+	if err != nil {
+		return nil, err
+	}
+
+	if r.regexCache == nil {
+		r.regexCache = make(map[string]*regexp.Regexp)
+	}
+	r.regexCache[pt] = re
+
+	return re, nil
+}
+
+func (r *Router) parseSlug(isStatic, reqValidation bool, s, url string) (Pattern, bool, bool, error) {
 	var slugPattern Pattern
 
 	if (len(s) >= 2 && (s[0] == '<' && s[len(s)-1] == '>')) || (len(s) >= 2 && (s[0] == '{' && s[len(s)-1] == '}')) {
@@ -190,20 +346,25 @@ func (r *Router) parseSlug(isStatic, reqValidation bool, s, url string) (Pattern
 
 		slugPattern.Slug = name
 		if pt == "" {
-			fmt.Printf("Error: Empty pattern in URL segment %q (route %s)\n", s, url)
-			os.Exit(3)
+			return slugPattern, isStatic, reqValidation, &RouteError{Route: url, Segment: s, Err: ErrEmptyPattern}
 		}
 		if pt != "any" {
 			reqValidation = true
 		}
 
-		if c := countCaptureGroups(pt); c > 0 {
+		if fn, ok, err := parseParametricMatcher(pt); ok {
+			if err != nil {
+				return slugPattern, isStatic, reqValidation, &RouteError{Route: url, Segment: s, Err: fmt.Errorf("invalid matcher %q: %w", pt, err)}
+			}
+			slugPattern.Fn = fn
+			slugPattern.Type = _PATTERN
+		} else if c, err := countCaptureGroups(pt); err == nil && c > 0 {
 			//FindAllStringSubmatch
-			if _, err := syntax.Parse(pt, syntax.PerlX); err != nil {
-				fmt.Printf("Error: Wrong regular expression %q in URL pattern %s\n", pt, url)
-				os.Exit(3)
+			re, err := r.compileRegex(pt)
+			if err != nil {
+				return slugPattern, isStatic, reqValidation, &RouteError{Route: url, Segment: s, Err: fmt.Errorf("wrong regular expression %q: %w", pt, err)}
 			}
-			slugPattern.RegexCompiled = regexp.MustCompile("^" + pt + "$")
+			slugPattern.RegexCompiled = re
 			slugPattern.Type = _SUBMATCH
 		} else {
 			//Match
@@ -211,20 +372,38 @@ func (r *Router) parseSlug(isStatic, reqValidation bool, s, url string) (Pattern
 				slugPattern.Fn = fn
 				slugPattern.Type = _PATTERN
 			} else {
-				if _, err := syntax.Parse(pt, syntax.PerlX); err != nil {
-					fmt.Printf("Error: Wrong regular expression %q in URL pattern %s\n", pt, url)
-					os.Exit(3)
+				re, err := r.compileRegex(pt)
+				if err != nil {
+					return slugPattern, isStatic, reqValidation, &RouteError{Route: url, Segment: s, Err: fmt.Errorf("wrong regular expression %q: %w", pt, err)}
 				}
-				slugPattern.RegexCompiled = regexp.MustCompile("^" + pt + "$")
+				slugPattern.RegexCompiled = re
 				slugPattern.Type = _MATCH
 			}
 		}
-		return slugPattern, isStatic, reqValidation
+		return slugPattern, isStatic, reqValidation, nil
 	}
 
-	slugPattern.Slug = s
+	slugPattern.Slug = unescapeSegment(s)
 	slugPattern.Type = _STRING
-	return slugPattern, isStatic, reqValidation
+	return slugPattern, isStatic, reqValidation, nil
+}
+
+func unescapeSegment(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case '<', '>', '{', '}', '\\':
+				i++
+			}
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
 }
 
 func splitPath(path string) []string {
@@ -249,7 +428,7 @@ func splitPath(path string) []string {
 	return segments
 }
 
-func (r *Router) preparePattern(url string) ([]Pattern, bool, bool, string) {
+func (r *Router) preparePattern(url string) ([]Pattern, bool, bool, string, error) {
 	var (
 		first         string
 		patterns      []Pattern
@@ -269,7 +448,10 @@ func (r *Router) preparePattern(url string) ([]Pattern, bool, bool, string) {
 			first = seg
 		}
 
-		p, st, rv := r.parseSlug(isStatic, reqValidation, seg, url)
+		p, st, rv, err := r.parseSlug(isStatic, reqValidation, seg, url)
+		if err != nil {
+			return nil, false, false, "", err
+		}
 
 		slugPart := p.Slug
 		if p.Type != _STRING {
@@ -285,7 +467,7 @@ func (r *Router) preparePattern(url string) ([]Pattern, bool, bool, string) {
 
 	radixURL := "/" + strings.Join(parts, "/")
 
-	return patterns, isStatic, reqValidation, radixURL
+	return patterns, isStatic, reqValidation, radixURL, nil
 }
 
 func (r *Router) validatePath(path string) {
@@ -296,28 +478,128 @@ func (r *Router) validatePath(path string) {
 }
 
 func (r *Router) HandleFunc(url string, methods string, fn HandlerFunc) {
-	patterns, isStatic, reqValidation, radixURL := r.preparePattern(url)
+	r.HandleFuncMeta(url, methods, RouteMeta{}, fn)
+}
+
+func (r *Router) HandleFuncMeta(url string, methods string, meta RouteMeta, fn HandlerFunc) {
+	if err := r.addRoute(url, methods, meta, fn); err != nil {
+		if errors.Is(err, ErrInvalidMethod) {
+			log.Fatalf("Invalid HTTP method in route %q methods %q", url, methods)
+		}
+		r.routeErrors = append(r.routeErrors, err)
+		r.log().Error("invalid route", "route", url, "error", err)
+	}
+}
+
+func (r *Router) HandleFuncErr(url string, methods string, fn HandlerFunc) error {
+	return r.addRoute(url, methods, RouteMeta{}, fn)
+}
+
+func (r *Router) GET(url string, fn HandlerFunc) {
+	r.handleMethod(url, GET, fn)
+}
+
+func (r *Router) POST(url string, fn HandlerFunc) {
+	r.handleMethod(url, POST, fn)
+}
+
+func (r *Router) PUT(url string, fn HandlerFunc) {
+	r.handleMethod(url, PUT, fn)
+}
+
+func (r *Router) DELETE(url string, fn HandlerFunc) {
+	r.handleMethod(url, DELETE, fn)
+}
+
+func (r *Router) PATCH(url string, fn HandlerFunc) {
+	r.handleMethod(url, PATCH, fn)
+}
+
+func (r *Router) handleMethod(url string, bitmask int, fn HandlerFunc) {
+	if err := r.addRouteMask(url, bitmask, RouteMeta{}, fn); err != nil {
+		r.routeErrors = append(r.routeErrors, err)
+		r.log().Error("invalid route", "route", url, "error", err)
+	}
+}
+
+func (r *Router) addRoute(url string, methods string, meta RouteMeta, fn HandlerFunc) error {
+	bitmask := r.MethodsToBitmask(methods)
+	if bitmask < 0 {
+		return fmt.Errorf("%w %q in route %q", ErrInvalidMethod, methods, url)
+	}
+
+	return r.addRouteMask(url, bitmask, meta, fn)
+}
+
+func (r *Router) addRouteMask(url string, bitmask int, meta RouteMeta, fn HandlerFunc) error {
+	r.mustNotBeSealed("HandleFunc")
+
+	if url == "" {
+		return ErrEmptyPattern
+	}
+
+	patterns, isStatic, reqValidation, radixURL, err := r.preparePattern(url)
+	if err != nil {
+		return err
+	}
 
 	entry := RouteEntry{
 		Route:      url,
 		Patterns:   patterns,
 		Handler:    fn,
-		Bitmask:    r.MethodsToBitmask(methods),
+		Bitmask:    bitmask,
 		Validation: reqValidation,
+		Meta:       meta,
 	}
+	entry.wrapped = r.wrap(url, fn)
 
-	if entry.Bitmask < 0 {
-		log.Fatalf("Invalid HTTP method in route %q methods %q", url, methods)
+	if cors := meta.CORS; cors != nil && cors.AllowCredentials && hasBareWildcard(cors.AllowedOrigins) {
+		r.log().Warn("CORS: AllowCredentials is not sent for origins matched only by \"*\"", "route", url)
+	}
+
+	for prefix := range r.staticFiles {
+		if prefix != "/" && strings.HasPrefix(url, prefix) {
+			r.log().Warn("route overlaps a static mount", "mount", prefix, "route", url)
+		}
 	}
 
 	if isStatic {
-		r.staticRoutes[url] = entry
+		key := unescapeSegment(url)
+		r.staticRoutes[key] = append(r.staticRoutes[key], entry)
 	} else {
 		r.insertNode(radixURL, entry)
 	}
+
+	return nil
+}
+
+func (r *Router) mustNotBeSealed(op string) {
+	if r.sealed.Load() {
+		panic(fmt.Sprintf("router: %s called after the router started serving; register routes and middleware before serving", op))
+	}
+}
+
+func (r *Router) Validate() error {
+	return errors.Join(r.routeErrors...)
+}
+
+func (r *Router) HandleFuncMulti(paths []string, methods string, fn HandlerFunc) {
+	for _, url := range paths {
+		r.HandleFunc(url, methods, fn)
+	}
 }
 
 func (r *Router) Static(dir string, replace string) {
+	r.StaticWithOptions(dir, replace, StaticOptions{})
+}
+
+func (r *Router) StaticWithCache(dir string, replace string, maxAge time.Duration) {
+	r.StaticWithOptions(dir, replace, StaticOptions{MaxAge: maxAge})
+}
+
+func (r *Router) StaticWithOptions(dir string, replace string, opts StaticOptions) {
+	r.mustNotBeSealed("Static")
+
 	if !strings.HasSuffix(replace, "/") {
 		replace += "/"
 	}
@@ -325,22 +607,113 @@ func (r *Router) Static(dir string, replace string) {
 	err := ensureDirectory(fmt.Sprintf("./%s", dir))
 
 	if err != nil {
-		log.Printf("Failed to create directory %s", err)
+		r.log().Error("failed to create static directory", "dir", dir, "error", err)
 	}
 
 	if r.staticFiles == nil {
 		r.staticFiles = make(map[string]http.Handler)
 	}
 
-	fs := http.FileServer(http.Dir("./" + dir))
+	if r.staticDirs == nil {
+		r.staticDirs = make(map[string]http.FileSystem)
+	}
+
+	if _, ok := r.staticFiles[replace]; ok {
+		r.log().Warn("static mount replaces an existing mount", "mount", replace, "dir", dir)
+	}
+	for _, route := range r.routesUnder(replace) {
+		r.log().Warn("static mount overlaps a registered route", "mount", replace, "route", route)
+	}
+
+	root := newStaticFileSystem(http.Dir("./"+dir), opts)
+	fs := http.FileServer(root)
+	if opts.MaxAge > 0 {
+		fs = staticCache(fs, root, opts.MaxAge)
+	}
 	r.staticFiles[replace] = http.StripPrefix(replace, fs)
+	r.staticDirs[replace] = root
 
 	faviconPath := fmt.Sprintf("./%s/favicon.ico", dir)
 	if _, err := os.Stat(faviconPath); err == nil {
-		r.HandleFunc("/favicon.ico", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
-			http.ServeFile(w, req, faviconPath)
-		})
+		r.File("/favicon.ico", faviconPath)
+	}
+}
+
+func (r *Router) File(route string, filepath string) {
+	r.GET(route, func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		http.ServeFile(w, req, filepath)
+	})
+}
+
+func (r *Router) StaticMounts() []string {
+	mounts := make([]string, 0, len(r.staticFiles))
+	for prefix := range r.staticFiles {
+		mounts = append(mounts, prefix)
+	}
+	sort.Strings(mounts)
+	return mounts
+}
+
+func (r *Router) routesUnder(prefix string) []string {
+	if prefix == "/" {
+		return nil
 	}
+
+	var routes []string
+	for url, entries := range r.staticRoutes {
+		if strings.HasPrefix(url, prefix) && len(entries) > 0 {
+			routes = append(routes, entries[0].Route)
+		}
+	}
+
+	var walk func(n *RadixNode)
+	walk = func(n *RadixNode) {
+		for _, e := range n.entries {
+			if strings.HasPrefix(e.Route, prefix) {
+				routes = append(routes, e.Route)
+			}
+		}
+		for _, ch := range n.children {
+			walk(ch)
+		}
+	}
+	if r.radixRoot != nil {
+		walk(r.radixRoot)
+	}
+
+	sort.Strings(routes)
+	return routes
+}
+
+func (r *Router) StaticPrecedence(order StaticPrecedence) {
+	r.mustNotBeSealed("StaticPrecedence")
+
+	r.staticOrder = order
+}
+
+func (r *Router) staticMount(path string) (string, http.Handler) {
+	best := ""
+	var bestH http.Handler
+	for prefix, h := range r.staticFiles {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(best) {
+			best, bestH = prefix, h
+		}
+	}
+	return best, bestH
+}
+
+func (r *Router) staticExists(prefix string, path string) bool {
+	root, ok := r.staticDirs[prefix]
+	if !ok {
+		return true
+	}
+
+	f, err := root.Open("/" + path[len(prefix):])
+	if err != nil {
+		return false
+	}
+	_ = f.Close()
+	return true
 }
 
 func (r *Router) EnableProfiling(profilingServer string) {
@@ -353,14 +726,16 @@ func (r *Router) EnableProfiling(profilingServer string) {
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
 	go func() {
-		log.Printf("[pprof] Profiling enabled at http://%s/debug/pprof/", profilingServer)
+		r.log().Info("profiling enabled", "url", "http://"+profilingServer+"/debug/pprof/")
 		if err := http.ListenAndServe(profilingServer, mux); err != nil {
-			log.Printf("[pprof] Error: %v", err)
+			r.log().Error("profiling server failed", "addr", profilingServer, "error", err)
 		}
 	}()
 }
 
 func (r *Router) Prefix(segment string) {
+	r.mustNotBeSealed("Prefix")
+
 	if segment == "" || segment == "/" {
 		r.prefixSegment = ""
 		return
@@ -378,17 +753,137 @@ func (r *Router) Prefix(segment string) {
 }
 
 func (r *Router) Recovery(fn HandlerFunc) {
+	r.mustNotBeSealed("Recovery")
+
 	r.recovery = fn
 }
 
+func (r *Router) OnPanic(fn func(req *http.Request, recovered any, stack []byte)) {
+	r.mustNotBeSealed("OnPanic")
+
+	r.onPanic = fn
+}
+
 func (r *Router) NotFound(fn HandlerFunc) {
+	r.mustNotBeSealed("NotFound")
+
 	r.notFound = fn
 }
 
+func (r *Router) Fallback(prefix string, fn HandlerFunc) {
+	r.mustNotBeSealed("Fallback")
+
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	if prefix != "/" {
+		prefix = strings.TrimSuffix(prefix, "/")
+	}
+
+	fb := fallbackRoute{prefix: prefix, handler: fn}
+	if fn != nil {
+		fb.wrapped = r.wrap("", fn)
+	}
+
+	for i := range r.fallbacks {
+		if r.fallbacks[i].prefix == prefix {
+			r.fallbacks[i] = fb
+			return
+		}
+	}
+
+	r.fallbacks = append(r.fallbacks, fb)
+	sort.SliceStable(r.fallbacks, func(i, j int) bool {
+		return len(r.fallbacks[i].prefix) > len(r.fallbacks[j].prefix)
+	})
+}
+
+func (r *Router) fallbackFor(req *http.Request) HandlerFunc {
+	if len(r.fallbacks) == 0 || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+		return nil
+	}
+
+	path := req.URL.Path
+	for _, fb := range r.fallbacks {
+		if fb.prefix == "/" || path == fb.prefix || strings.HasPrefix(path, fb.prefix+"/") {
+			return fb.wrapped
+		}
+	}
+
+	return nil
+}
+
+func (r *Router) NotFoundBody(body []byte, contentType string) {
+	r.mustNotBeSealed("NotFoundBody")
+
+	r.notFoundBody = body
+	r.notFoundType = contentType
+}
+
+func (r *Router) NotFoundJSON() {
+	r.NotFoundBody(notFoundJSON, "application/json")
+}
+
 func (r *Router) TerminalOutput(terminal bool) {
+	r.mustNotBeSealed("TerminalOutput")
+
 	r.terminalOutput = terminal
 }
 
+func (r *Router) RawPathParams(raw bool) {
+	r.mustNotBeSealed("RawPathParams")
+
+	r.rawPathParams = raw
+}
+
+func (r *Router) routingPath(req *http.Request) (string, bool) {
+	if r.rawPathParams {
+		return req.URL.EscapedPath(), false
+	}
+
+	raw := req.URL.EscapedPath()
+	if indexEncodedSlash(raw) == -1 {
+		return req.URL.Path, false
+	}
+
+	var b strings.Builder
+	for {
+		i := indexEncodedSlash(raw)
+		if i == -1 {
+			break
+		}
+		part, err := url.PathUnescape(raw[:i])
+		if err != nil {
+			return req.URL.Path, false
+		}
+		b.WriteString(strings.ReplaceAll(part, "%", "%25"))
+		b.WriteString("%2F")
+		raw = raw[i+3:]
+	}
+
+	part, err := url.PathUnescape(raw)
+	if err != nil {
+		return req.URL.Path, false
+	}
+	b.WriteString(strings.ReplaceAll(part, "%", "%25"))
+
+	return b.String(), true
+}
+
+// encodedSlashUnescaper decodes segment values of a routing path built by
+// routingPath, where literal percent signs are kept as %25 so they cannot be
+// confused with an encoded slash.
+var encodedSlashUnescaper = strings.NewReplacer("%2F", "/", "%25", "%")
+
+func indexEncodedSlash(s string) int {
+	for i := 0; i+2 < len(s); i++ {
+		if s[i] == '%' && s[i+1] == '2' && (s[i+2] == 'F' || s[i+2] == 'f') {
+			return i
+		}
+	}
+	return -1
+}
+
 func (r *Router) getErrorMessage(message any) error {
 	var err error
 
@@ -405,28 +900,62 @@ func (r *Router) getErrorMessage(message any) error {
 }
 
 func (r *Router) secondaryRecover(w http.ResponseWriter, req *http.Request, ctx *Context, msg string) {
-	func() {
-		if message := recover(); message != nil {
-			logError(req, message, r.getErrorMessage(message), r.terminalOutput)
-			http.Error(w, msg, http.StatusInternalServerError)
-		}
+	if message := recover(); message != nil {
+		r.logPanic(req, ctx, message)
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
+
+func (r *Router) runRecovery(w http.ResponseWriter, req *http.Request, ctx *Context) {
+	defer r.secondaryRecover(w, req, ctx, "Recovery middleware failed: an error occurred while executing the recovery handler.")
+	r.recovery(w, req, ctx)
+}
 
-		if ctx != nil {
-			contextPool.Put(ctx)
+func (r *Router) runPanicHook(req *http.Request, recovered any, stack []byte) {
+	defer func() {
+		if m := recover(); m != nil {
+			r.log().Error("OnPanic hook failed", "error", m)
 		}
 	}()
+
+	r.onPanic(req, recovered, stack)
 }
 
 func (r *Router) Run(w http.ResponseWriter, req *http.Request, handler HandlerFunc, ctx *Context) {
 	if r.terminalOutput {
 		start := time.Now()
 		handler(w, req, ctx)
-		logRequest(req, start)
+		r.logRequest(req, start)
 	} else {
 		handler(w, req, ctx)
 	}
 }
 
+func (r *Router) runRoute(w http.ResponseWriter, req *http.Request, handler HandlerFunc, ctx *Context) {
+	if req.Method != http.MethodHead {
+		r.Run(w, req, handler, ctx)
+		return
+	}
+
+	hw := &headWriter{ResponseWriter: w}
+	r.Run(hw, req, handler, ctx)
+	hw.finish()
+}
+
+func (r *Router) write404(w http.ResponseWriter) {
+	if r.notFoundBody == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write(notFound)
+		return
+	}
+
+	if r.notFoundType != "" {
+		w.Header().Set("Content-Type", r.notFoundType)
+	}
+	w.WriteHeader(http.StatusNotFound)
+	_, _ = w.Write(r.notFoundBody)
+}
+
 func (r *Router) write405(w http.ResponseWriter, mask int) {
 	allow := r.maskToAllowHeader(mask)
 	if allow != "" {
@@ -436,6 +965,47 @@ func (r *Router) write405(w http.ResponseWriter, mask int) {
 	_, _ = w.Write([]byte("405 method not allowed"))
 }
 
+func (r *Router) writeOptions(w http.ResponseWriter, req *http.Request, mask int, meta RouteMeta) {
+	h := w.Header()
+	allow := r.maskToAllowHeader(mask)
+	h.Set("Allow", allow)
+
+	if cors := meta.CORS; cors != nil {
+		origin := req.Header.Get("Origin")
+		if origin != "" && req.Header.Get("Access-Control-Request-Method") != "" && matchOrigin(origin, cors.AllowedOrigins) {
+			addVary(h, "Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Origin", origin)
+
+			if corsCredentials(cors, origin) {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if len(cors.AllowedMethods) > 0 {
+				h.Set("Access-Control-Allow-Methods", strings.Join(cors.AllowedMethods, ", "))
+			} else {
+				h.Set("Access-Control-Allow-Methods", allow)
+			}
+			if len(cors.AllowedHeaders) > 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(cors.AllowedHeaders, ", "))
+			}
+			if cors.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func routeMeta(entries []RouteEntry) RouteMeta {
+	for i := range entries {
+		if entries[i].Meta.CORS != nil {
+			return entries[i].Meta
+		}
+	}
+	return RouteMeta{}
+}
+
 func (r *Router) maskToAllowHeader(mask int) string {
 	have := map[string]bool{}
 	if mask&GET != 0 {
@@ -465,169 +1035,289 @@ func (r *Router) maskToAllowHeader(mask int) string {
 	return strings.Join(out, ", ")
 }
 
-func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+func (r *Router) acquireContext(w http.ResponseWriter, req *http.Request) (*Context, http.ResponseWriter) {
 	ctx := GetContext()
+	ctx.router = r
+	ctx.Request = req
+	ctx.writer.reset(w)
+	return ctx, ctx.writer.view()
+}
 
-	defer func() {
-		if m := recover(); m != nil {
-			err := r.getErrorMessage(m)
-			if err != nil {
-				logError(req, m, err, r.terminalOutput)
-				if r.recovery != nil {
-					defer r.secondaryRecover(w, req, ctx, "Recovery middleware failed: an error occurred while executing the recovery handler.")
-					r.recovery(w, req, ctx)
-				} else {
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				}
+func (r *Router) releaseContext(w http.ResponseWriter, req *http.Request, ctx *Context) {
+	defer PutContext(ctx)
+
+	if m := recover(); m != nil {
+		err := r.getErrorMessage(m)
+		if err != nil {
+			r.logPanic(req, ctx, m)
+
+			var stack []byte
+			if r.onPanic != nil || r.recovery != nil {
+				stack = fullStack()
+			}
+			if r.onPanic != nil {
+				r.runPanicHook(req, m, stack)
+			}
+
+			if r.recovery != nil {
+				ctx.Set("panic", m)
+				ctx.Set("stack", stack)
+				r.runRecovery(w, req, ctx)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
 		}
+	}
 
-		PutContext(ctx)
-	}()
+	ctx.runComplete()
+}
+
+func (r *Router) ToHTTP(fn HandlerFunc) http.HandlerFunc {
+	a := &adaptedHandler{handler: fn, wrapped: r.wrap("", fn)}
+	if !r.sealed.Load() {
+		r.adapted = append(r.adapted, a)
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.seal()
+
+		ctx, w := r.acquireContext(w, req)
+		defer r.releaseContext(w, req, ctx)
+
+		r.Run(w, req, a.wrapped, ctx)
+	}
+}
+
+func (r *Router) PreRoute(fn func(w http.ResponseWriter, req *http.Request) bool) {
+	r.mustNotBeSealed("PreRoute")
+	r.preRoute = append(r.preRoute, fn)
+}
+
+func (r *Router) runPreRoute(w http.ResponseWriter, req *http.Request) bool {
+	if r.rejectDotSegments && hasDotDotSegment(req.URL.Path) {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return false
+	}
+
+	for _, fn := range r.preRoute {
+		if !fn(w, req) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasDotDotSegment(path string) bool {
+	for {
+		i := strings.IndexByte(path, '/')
+		seg := path
+		if i != -1 {
+			seg = path[:i]
+		}
+		if seg == ".." {
+			return true
+		}
+		if i == -1 {
+			return false
+		}
+		path = path[i+1:]
+	}
+}
+
+func (r *Router) RejectDotSegments(reject bool) {
+	r.mustNotBeSealed("RejectDotSegments")
+
+	r.rejectDotSegments = reject
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !r.runPreRoute(w, req) {
+		return
+	}
+	r.serve(w, req, nil)
+}
+
+func (r *Router) seal() {
+	if !r.sealed.Load() {
+		r.sealed.Store(true)
+	}
+}
+
+func (r *Router) serve(w http.ResponseWriter, req *http.Request, fallback http.Handler) {
+	r.seal()
+
+	ctx, w := r.acquireContext(w, req)
+	defer r.releaseContext(w, req, ctx)
 
 	var foundPath bool
 	var allowedMask int
 
-	p := req.URL.Path
-	t := r.staticRoutes[p]
+	p, encodedSlash := r.routingPath(req)
+
+	if static := r.staticRoutes[p]; len(static) > 0 {
 
-	if t.Route != "" {
+		method := methodBit(req.Method)
+		if method == HEAD {
+			method |= GET
+		}
+
+		for i := range static {
+			t := &static[i]
+			allowedMask |= t.Bitmask
 
-		method := r.getBitmaskIndex(req.Method)
+			if t.Bitmask&method == 0 {
+				continue
+			}
 
-		if t.Bitmask&method != 0 {
 			ctx.Params = ctx.Params[:0]
 			ctx.paramMap = nil
 			ctx.Entries = ctx.Entries[:0]
+			ctx.route = t.Route
 
-			handler := t.Handler
-			handler = r.wrap(t.Route, t.Handler)
+			if t.Meta.ContentType != "" {
+				w.Header().Set("Content-Type", t.Meta.ContentType)
+			}
+
+			r.runRoute(w, req, r.routeHandler(t), ctx)
+			return
+		}
 
-			r.Run(w, req, handler, ctx)
+		if req.Method == http.MethodOptions {
+			r.writeOptions(w, req, allowedMask, routeMeta(static))
 			return
 		}
 
-		r.write405(w, t.Bitmask)
+		r.write405(w, allowedMask)
 		return
 
 	} else if ok := r.searchAll(p, ctx); ok {
 
-		start := -1
-
-		for j := 0; j < len(p); j++ {
-			if p[j] != '/' {
-				if start == -1 {
-					start = j
-				}
-			} else if start != -1 {
-				ctx.Segments = append(ctx.Segments, Seg{p[start:j]})
-				start = -1
+		if encodedSlash {
+			for i := range ctx.Segments {
+				ctx.Segments[i].Value = encodedSlashUnescaper.Replace(ctx.Segments[i].Value)
 			}
 		}
 
-		foundPath = false
-		allowedMask = 0
-
-		if start != -1 {
+		slot := bits.TrailingZeros(uint(methodBit(req.Method)))
 
-			ctx.Segments = append(ctx.Segments, Seg{p[start:]})
+		for _, leaf := range ctx.leaves {
+			for _, i := range leaf.index.methods[slot] {
+				entry := &leaf.entries[i]
 
-			bitmask := r.getBitmaskIndex(req.Method)
-
-		outer:
-			for i := 0; i < len(ctx.Entries); i++ {
-				entry := &ctx.Entries[i]
-
-				foundPath = true
-				allowedMask |= entry.Bitmask
-
-				if entry.Bitmask&bitmask == 0 {
+				if entry.Validation && !entry.validate(ctx.Segments) {
 					continue
 				}
 
-				if entry.Validation {
-					for depth := 0; depth < len(entry.Patterns); depth++ {
-						p := entry.Patterns[depth]
-						segment := ctx.Segments[depth].Value
-
-						if p.Type != _STRING {
-							switch p.Type {
-							case _MATCH:
-								if !p.RegexCompiled.MatchString(segment) {
-									continue outer
-								}
-							case _PATTERN:
-								if !p.Fn(segment) {
-									continue outer
-								}
-							case _SUBMATCH:
-								if len(p.RegexCompiled.FindStringSubmatch(segment)) == 0 {
-									continue outer
-								}
-							}
-						}
-					}
-				}
-
 				ctx.Params = ctx.Params[:0]
 				ctx.paramMap = nil
 				ctx.Entries = append(ctx.Entries[:0], *entry)
+				ctx.route = entry.Route
 
-				handler := r.wrap(entry.Route, entry.Handler)
-				r.Run(w, req, handler, ctx)
+				if entry.Meta.ContentType != "" {
+					w.Header().Set("Content-Type", entry.Meta.ContentType)
+				}
+
+				r.runRoute(w, req, r.routeHandler(entry), ctx)
 				return
 			}
 		}
+
+		for _, leaf := range ctx.leaves {
+			for i := range leaf.entries {
+				entry := &leaf.entries[i]
+
+				if entry.Validation && !entry.validate(ctx.Segments) {
+					continue
+				}
+
+				foundPath = true
+				allowedMask |= entry.Bitmask
+				ctx.Entries = append(ctx.Entries, *entry)
+			}
+		}
 	}
 
 	if foundPath {
+		if req.Method == http.MethodOptions {
+			r.writeOptions(w, req, allowedMask, routeMeta(ctx.Entries))
+			return
+		}
+
 		r.write405(w, allowedMask)
 		return
 	}
 
-	if r.notFound != nil {
+	if fallback != nil {
+		fallback.ServeHTTP(w, req)
+	} else if fb := r.fallbackFor(req); fb != nil {
+		r.runRoute(w, req, fb, ctx)
+	} else if r.notFound != nil {
 		r.notFound(w, req, ctx)
 	} else {
-		w.WriteHeader(http.StatusNotFound)
-		_, _ = w.Write(notFound)
+		r.write404(w)
 	}
 }
 
 func (r *Router) Handler() http.HandlerFunc {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !r.runPreRoute(w, req) {
+			return
+		}
 
 		path := req.URL.Path
-		best := ""
-		var bestH http.Handler
-		for prefix, h := range r.staticFiles {
-			if strings.HasPrefix(path, prefix) && len(prefix) > len(best) {
-				best, bestH = prefix, h
-			}
-		}
+		best, bestH := r.staticMount(path)
+
+		var fallback http.Handler
 		if bestH != nil {
-			bestH.ServeHTTP(w, req)
-			return
+			if r.staticOrder == RoutesFirst {
+				fallback = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					req.URL.Path = path
+					bestH.ServeHTTP(w, req)
+				})
+			} else if r.staticExists(best, path) {
+				bestH.ServeHTTP(w, req)
+				return
+			}
 		}
 
 		if r.prefixSegment != "" {
-			seg := r.prefixSegment
-			segLen := len(seg)
-			if path == seg {
-				req.URL.Path = "/"
-			} else if len(path) > segLen &&
-				path[:segLen] == seg &&
-				path[segLen] == '/' {
-
-				req.URL.Path = path[segLen:]
-			}
+			stripPrefixSegment(req.URL, r.prefixSegment)
 		}
 
-		r.ServeHTTP(w, req)
+		r.serve(w, req, fallback)
 	})
 
 	return handler
 }
 
+// stripPrefixSegment removes seg from the start of u's path, keeping RawPath
+// in step so encoded slashes survive the rewrite.
+func stripPrefixSegment(u *url.URL, seg string) {
+	strip := func(p string) (string, bool) {
+		if p == seg {
+			return "/", true
+		}
+		if len(p) > len(seg) && p[:len(seg)] == seg && p[len(seg)] == '/' {
+			return p[len(seg):], true
+		}
+		return p, false
+	}
+
+	path, ok := strip(u.Path)
+	if !ok {
+		return
+	}
+	u.Path = path
+
+	if u.RawPath != "" {
+		if raw, ok := strip(u.RawPath); ok {
+			u.RawPath = raw
+		} else {
+			u.RawPath = ""
+		}
+	}
+}
+
 func (r *Router) Group(prefix string) *RouteGroup {
 	if prefix == "" || prefix == "/" {
 		log.Fatalf("router: invalid group prefix %q (cannot be empty or '/')", prefix)
@@ -646,210 +1336,339 @@ func (r *Router) Group(prefix string) *RouteGroup {
 }
 
 func (g *RouteGroup) HandleFunc(url string, methods string, fn HandlerFunc) {
+	g.HandleFuncMeta(url, methods, RouteMeta{}, fn)
+}
+
+func (g *RouteGroup) HandleFuncMeta(url string, methods string, meta RouteMeta, fn HandlerFunc) {
 	if !strings.HasPrefix(url, "/") {
 		url = "/" + url
 	}
 
 	full := g.prefix + url
 
+	if meta.ContentType == "" {
+		meta.ContentType = g.contentType
+	}
+
 	g.r.insertGroupMiddleware(g.prefix, full)
-	g.r.HandleFunc(full, methods, fn)
+	g.r.HandleFuncMeta(full, methods, meta, fn)
 }
 
 func (g *RouteGroup) Use(m Middleware) {
 	g.r.useGroup(m, g.prefix)
 }
 
+func (g *RouteGroup) ContentType(contentType string) *RouteGroup {
+	g.contentType = contentType
+	return g
+}
+
+type HealthCheck struct {
+	Name  string
+	Check func() error
+}
+
 func (r *Router) Ready() {
-	r.HandleFunc("/ready", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
-		if r.IsReady() {
-			w.WriteHeader(http.StatusOK)
-			_, err := w.Write([]byte("ok"))
-			if err != nil {
-				return
-			}
-		} else {
+	r.Health("/ready", HealthCheck{Name: "routes", Check: r.Validate})
+}
+
+func (r *Router) Health(path string, checks ...HealthCheck) {
+	r.HandleFunc(path, "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		if !r.IsReady() {
 			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		var failing []string
+		for _, check := range checks {
+			if err := check.Check(); err != nil {
+				failing = append(failing, check.Name)
+			}
+		}
+
+		if len(failing) > 0 {
+			JSON(w, http.StatusServiceUnavailable, map[string]any{
+				"status":  "unavailable",
+				"failing": failing,
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("ok"))
+		if err != nil {
+			return
 		}
 	})
 }
 
+func (r *Router) newServer(ln Listener) *http.Server {
+	var handler http.Handler = r.Handler()
+	if ln.Handler != nil {
+		handler = ln.Handler
+	}
+
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+		ConnState:         r.conns.track,
+	}
+}
+
 func (r *Router) MultiListenAndServe(listeners Listeners) {
-	debug.SetGCPercent(300)
+	if err := r.MultiListenAndServeErr(listeners); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
 
-	workers := runtime.NumCPU()
-	runtime.GOMAXPROCS(workers)
+func (r *Router) Workers(n int) {
+	r.workers = n
+}
 
-	if r.terminalOutput {
-		Log("INFO", "Using %d CPU core%s", workers, map[bool]string{true: "s", false: ""}[workers != 1])
+func (r *Router) TuneRuntime(tune bool) {
+	r.keepRuntime = !tune
+}
+
+func (r *Router) workerCount() int {
+	if !r.keepRuntime {
+		debug.SetGCPercent(300)
+		runtime.GOMAXPROCS(runtime.NumCPU())
 	}
 
-	var (
-		wg      sync.WaitGroup
-		servers []*http.Server
-		mu      sync.Mutex
-	)
+	if r.workers > 0 {
+		return r.workers
+	}
+	if r.keepRuntime {
+		return runtime.GOMAXPROCS(0)
+	}
+	return runtime.NumCPU()
+}
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+func (r *Router) MultiListenAndServeErr(listeners Listeners) error {
+	return r.Serve(context.Background(), listeners)
+}
 
-	for _, ln := range listeners {
-		listenAddr := ln.Listen
+func (r *Router) Serve(ctx context.Context, listeners Listeners) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
 
-		_, portStr, err := net.SplitHostPort(listenAddr)
-		if err != nil {
-			log.Fatalf("Invalid listen address %s: %v", listenAddr, err)
-		}
-		port, err := strconv.Atoi(portStr)
+	r.sealed.Store(true)
+
+	workers := r.workerCount()
+
+	if r.logsEnabled() {
+		r.log().Info("starting servers", "workers", workers)
+	}
+
+	ports := make([]int, len(listeners))
+	tlsConfigs := make([]*tls.Config, len(listeners))
+	for i, ln := range listeners {
+		port, err := listenPort(ln.Listen)
 		if err != nil {
-			log.Fatalf("Invalid port format for %s: %v", listenAddr, err)
+			return err
 		}
+		ports[i] = port
 
-		if r.terminalOutput {
-			printServerInfo(serverName, serverVersion, port)
+		if tlsConfigs[i], err = ln.tlsConfig(); err != nil {
+			return err
 		}
+	}
 
-		useReusePort := runtime.GOOS != "windows"
-		var reuseErr error
-
-		var probe net.Listener
-		if useReusePort {
-			lc := net.ListenConfig{
-				Control: func(network, address string, c syscall.RawConn) error {
-					var sockErr error
-					if err := c.Control(func(fd uintptr) {
-						_ = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
-						if e := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); e != nil {
-							sockErr = e
-						}
-					}); err != nil {
-						return err
-					}
-					return sockErr
-				},
-			}
-			probe, reuseErr = lc.Listen(context.Background(), "tcp", listenAddr)
-			if reuseErr == nil {
-				_ = probe.Close()
+	bound := make([][]net.Listener, 0, len(listeners))
+	for _, ln := range listeners {
+		ls, err := r.bindListeners(ln.Listen, workers)
+		if err != nil {
+			for _, group := range bound {
+				for _, l := range group {
+					_ = l.Close()
+				}
 			}
+			return err
 		}
+		bound = append(bound, ls)
+	}
 
-		if useReusePort && reuseErr == nil {
-			for i := 0; i < workers; i++ {
-				wg.Add(1)
-				go func(addr string) {
-					defer wg.Done()
-
-					lc := net.ListenConfig{
-						Control: func(network, address string, c syscall.RawConn) error {
-							var sockErr error
-							if err := c.Control(func(fd uintptr) {
-								_ = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
-								if e := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); e != nil {
-									sockErr = e
-								}
-							}); err != nil {
-								return err
-							}
-							return sockErr
-						},
-					}
+	return r.serveBound(ctx, listeners, ports, bound, tlsConfigs)
+}
 
-					raw, err := lc.Listen(context.Background(), "tcp", addr)
-					if err != nil {
-						if r.terminalOutput {
-							Log("ERROR", "REUSEPORT listen failed on %s: %v", addr, err)
-						}
-						return
-					}
+// serveBound runs a server per bound listener until ctx is done, a shutdown
+// signal arrives or a server fails. The first server error shuts down the
+// others and is returned.
+func (r *Router) serveBound(ctx context.Context, listeners Listeners, ports []int, bound [][]net.Listener, tlsConfigs []*tls.Config) error {
+	var (
+		wg      sync.WaitGroup
+		servers []*http.Server
+	)
 
-					listener := raw
+	total := 0
+	for _, group := range bound {
+		total += len(group)
+	}
+	errs := make(chan error, total)
 
-					server := &http.Server{
-						Handler:           r.Handler(),
-						ReadTimeout:       5 * time.Second,
-						WriteTimeout:      10 * time.Second,
-						IdleTimeout:       120 * time.Second,
-						ReadHeaderTimeout: 2 * time.Second,
-					}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
 
-					mu.Lock()
-					servers = append(servers, server)
-					mu.Unlock()
+	for i, ln := range listeners {
+		listenAddr := ln.Listen
 
-					if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
-						if r.terminalOutput {
-							Log("ERROR", "Server error on %s: %v", addr, err)
-						}
-					}
-				}(listenAddr)
-			}
-		} else {
+		if r.logsEnabled() {
+			r.logServerStart(listenAddr, ports[i])
+		}
 
-			if r.terminalOutput && reuseErr != nil {
-				Log("WARN", "REUSEPORT unavailable on %s: %v; falling back to single listener", listenAddr, reuseErr)
-			}
+		for _, l := range bound[i] {
+			server := r.newServer(ln)
+			servers = append(servers, server)
 
 			wg.Add(1)
-			go func(addr string) {
+			go func(addr string, server *http.Server, l net.Listener, cfg *tls.Config) {
 				defer wg.Done()
 
-				l, err := net.Listen("tcp", addr)
-				if err != nil {
-					log.Fatalf("Failed to listen on %s: %v", addr, err)
+				if err := r.serveListener(server, l, cfg); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					if r.logsEnabled() {
+						r.log().Error("server error", "addr", addr, "error", err)
+					}
+					errs <- fmt.Errorf("router: server error on %s: %w", addr, err)
 				}
+			}(listenAddr, server, l, tlsConfigs[i])
+		}
+	}
 
-				server := &http.Server{
-					Handler:           r.Handler(),
-					ReadTimeout:       5 * time.Second,
-					WriteTimeout:      10 * time.Second,
-					IdleTimeout:       120 * time.Second,
-					ReadHeaderTimeout: 2 * time.Second,
-				}
+	var serveErr error
+	select {
+	case <-stop:
+	case <-ctx.Done():
+	case serveErr = <-errs:
+	}
+	deadline := time.Now().Add(r.preShutdownDelay + shutdownTimeout)
+	r.markShutdown(deadline)
 
-				mu.Lock()
-				servers = append(servers, server)
-				mu.Unlock()
+	immediate := false
+	if serveErr != nil {
+		if r.logsEnabled() {
+			r.log().Warn("shutting down servers after a server error")
+		}
+	} else if r.preShutdownDelay > 0 {
+		if r.logsEnabled() {
+			r.log().Info("shutdown signal received, draining", "delay", r.preShutdownDelay)
+		}
 
-				if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
-					if r.terminalOutput {
-						Log("ERROR", "Server error on %s: %v", addr, err)
-					}
-				}
-			}(listenAddr)
+		timer := time.NewTimer(r.preShutdownDelay)
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			immediate = true
 		}
 	}
 
-	<-stop
-	r.SetReady(false)
-	if r.terminalOutput {
-		Log("INFO", "Shutdown signal received. Shutting down servers...")
+	if immediate {
+		if r.logsEnabled() {
+			r.log().Warn("second shutdown signal received, closing servers immediately")
+		}
+	} else if serveErr == nil && r.logsEnabled() {
+		r.log().Info("shutdown signal received, shutting down servers")
 	}
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithDeadline(context.Background(), deadline)
 	defer cancel()
 
-	mu.Lock()
 	for _, srv := range servers {
 		go func(s *http.Server) {
-			if err := s.Shutdown(shutdownCtx); err != nil && r.terminalOutput {
-				Log("WARN", "Server shutdown error: %v", err)
+			if immediate {
+				_ = s.Close()
+				return
+			}
+			if err := s.Shutdown(shutdownCtx); err != nil && r.logsEnabled() {
+				r.log().Warn("server shutdown error", "error", err)
 			}
 		}(srv)
 	}
-	mu.Unlock()
 
 	wg.Wait()
 
-	if r.terminalOutput {
-		Log("INFO", "All servers shut down gracefully.")
+	if serveErr != nil {
+		return serveErr
+	}
+
+	if r.logsEnabled() {
+		r.log().Info("all servers shut down gracefully")
 	}
+
+	return nil
+}
+
+func listenPort(addr string) (int, error) {
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, fmt.Errorf("router: invalid listen address %s: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return 0, fmt.Errorf("router: invalid port format for %s: %w", addr, err)
+	}
+	return port, nil
+}
+
+func (r *Router) bindListeners(addr string, workers int) ([]net.Listener, error) {
+	var bound []net.Listener
+	var reuseErr error
+
+	if reusePortSupported {
+		lc := reusePortListenConfig()
+		bindAddr := addr
+		for i := 0; i < workers; i++ {
+			l, err := lc.Listen(context.Background(), "tcp", bindAddr)
+			if err != nil {
+				reuseErr = err
+				if len(bound) == 0 {
+					break
+				}
+				continue
+			}
+			if len(bound) == 0 {
+				bindAddr = l.Addr().String()
+			}
+			bound = append(bound, l)
+		}
+	}
+
+	switch {
+	case len(bound) == 0 && reuseErr != nil:
+		if r.logsEnabled() {
+			r.log().Warn("REUSEPORT unavailable, falling back to a single listener", "addr", addr, "error", reuseErr)
+		}
+	case len(bound) < workers && reuseErr != nil:
+		if r.logsEnabled() {
+			r.log().Warn("REUSEPORT bound fewer listeners than workers", "addr", addr, "bound", len(bound), "workers", workers, "error", reuseErr)
+		}
+	}
+
+	if len(bound) == 0 {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("router: failed to listen on %s: %w", addr, err)
+		}
+		bound = append(bound, l)
+	}
+
+	return bound, nil
 }
 
 func (r *Router) ListenAndServe(port int) {
+	if err := r.ListenAndServeErr(port); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
 
+func (r *Router) ListenAndServeErr(port int) error {
 	listen := fmt.Sprintf("localhost:%d", port)
-	r.MultiListenAndServe(Listeners{
+	return r.MultiListenAndServeErr(Listeners{
 		{Listen: listen, Domain: listen},
 	})
 }
@@ -1,13 +1,24 @@
 package router
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -84,6 +95,234 @@ func TestRecoveryFromPanic(t *testing.T) {
 	}
 }
 
+type recoveryTestError struct{ code int }
+
+func (e recoveryTestError) Error() string { return "recovery test error" }
+
+func TestRecoveryReceivesPanicValueAndStack(t *testing.T) {
+	defer os.RemoveAll("./logs")
+
+	r := newTestableRouter()
+
+	r.Recovery(func(w http.ResponseWriter, _ *http.Request, ctx *Context) {
+		stack, _ := ctx.Get("stack").([]byte)
+		if !bytes.Contains(stack, []byte("router_test.go")) {
+			t.Errorf("expected stack to include the panicking handler, got %q", stack)
+		}
+
+		if e, ok := ctx.Get("panic").(recoveryTestError); ok {
+			w.WriteHeader(e.code)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	r.HandleFunc("/panic", "GET", func(w http.ResponseWriter, _ *http.Request, ctx *Context) {
+		panic(recoveryTestError{code: http.StatusServiceUnavailable})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 from the typed panic, got %d", w.Code)
+	}
+}
+
+func TestOnPanicRunsBeforeRecovery(t *testing.T) {
+	defer os.RemoveAll("./logs")
+
+	r := newTestableRouter()
+
+	var order []string
+	var gotValue any
+	var gotStack []byte
+
+	r.OnPanic(func(req *http.Request, recovered any, stack []byte) {
+		order = append(order, "hook")
+		gotValue = recovered
+		gotStack = stack
+	})
+	r.Recovery(func(w http.ResponseWriter, _ *http.Request, ctx *Context) {
+		order = append(order, "recovery")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	r.HandleFunc("/panic", "GET", func(w http.ResponseWriter, _ *http.Request, ctx *Context) {
+		panic("fail")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if strings.Join(order, ",") != "hook,recovery" {
+		t.Errorf("expected hook before recovery, got %v", order)
+	}
+	if gotValue != "fail" {
+		t.Errorf("expected recovered value %q, got %v", "fail", gotValue)
+	}
+	if !bytes.Contains(gotStack, []byte("router_test.go")) {
+		t.Errorf("expected stack to include the panicking handler, got %q", gotStack)
+	}
+	if w.Code != http.StatusTeapot {
+		t.Errorf("expected status 418, got %d", w.Code)
+	}
+}
+
+func TestRecoveryReturnsContextToPoolOnce(t *testing.T) {
+	defer os.RemoveAll("./logs")
+
+	for _, recoveryPanics := range []bool{false, true} {
+		r := newTestableRouter()
+
+		completed := 0
+		r.Recovery(func(w http.ResponseWriter, _ *http.Request, ctx *Context) {
+			if recoveryPanics {
+				panic("recovery failed too")
+			}
+			w.WriteHeader(http.StatusTeapot)
+		})
+		r.HandleFunc("/panic", "GET", func(w http.ResponseWriter, _ *http.Request, ctx *Context) {
+			ctx.OnComplete(func() { completed++ })
+			panic("fail")
+		})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+		want := http.StatusTeapot
+		if recoveryPanics {
+			want = http.StatusInternalServerError
+		}
+		if w.Code != want || completed != 1 {
+			t.Errorf("recovery panics=%v: expected status %d and one OnComplete call, got %d and %d", recoveryPanics, want, w.Code, completed)
+		}
+
+		c1, c2 := GetContext(), GetContext()
+		if c1 == c2 {
+			t.Fatalf("recovery panics=%v: the same context was handed out twice", recoveryPanics)
+		}
+		PutContext(c1)
+		PutContext(c2)
+	}
+}
+
+func TestRecoveryPanicsUnderConcurrency(t *testing.T) {
+	defer os.RemoveAll("./logs")
+
+	r := newTestableRouter()
+	r.SetLogger(&recordingLogger{})
+	r.Recovery(func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		if req.URL.Query().Get("nested") != "" {
+			panic("recovery failed too")
+		}
+		w.WriteHeader(http.StatusTeapot)
+	})
+	r.HandleFunc("/work/<id:isDigits>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		id, _ := ctx.Param("id")
+		ctx.Set("id", id)
+		runtime.Gosched()
+		if got := ctx.GetString("id"); got != id {
+			t.Errorf("context shared between requests: expected id %s, got %s", id, got)
+		}
+		if req.URL.Query().Get("panic") != "" {
+			panic("fail")
+		}
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				path := "/work/" + strconv.Itoa(g*1000+i)
+				want := http.StatusOK
+				switch i % 3 {
+				case 1:
+					path += "?panic=1"
+					want = http.StatusTeapot
+				case 2:
+					path += "?panic=1&nested=1"
+					want = http.StatusInternalServerError
+				}
+
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				if w.Code != want {
+					t.Errorf("%s: expected %d, got %d", path, want, w.Code)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestRouterIsSealedOnceServing(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.HandleFunc("/before", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {})
+	r.Use(func(next HandlerFunc) HandlerFunc { return next })
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/before", nil))
+
+	calls := map[string]func(){
+		"HandleFunc":         func() { r.HandleFunc("/after", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {}) },
+		"Use":                func() { r.Use(func(next HandlerFunc) HandlerFunc { return next }) },
+		"Prefix":             func() { r.Prefix("/v2") },
+		"PreRoute":           func() { r.PreRoute(func(w http.ResponseWriter, req *http.Request) bool { return true }) },
+		"NotFound":           func() { r.NotFound(func(w http.ResponseWriter, req *http.Request, ctx *Context) {}) },
+		"Recovery":           func() { r.Recovery(func(w http.ResponseWriter, req *http.Request, ctx *Context) {}) },
+		"SetLogger":          func() { r.SetLogger(&recordingLogger{}) },
+		"StaticPrecedence":   func() { r.StaticPrecedence(RoutesFirst) },
+		"RejectDotSegments":  func() { r.RejectDotSegments(true) },
+		"TerminalOutput":     func() { r.TerminalOutput(true) },
+		"VerboseStackTraces": func() { r.VerboseStackTraces(true) },
+		"SetErrorLogger":     func() { r.SetErrorLogger(slog.Default()) },
+		"SetTrustedProxies":  func() { r.SetTrustedProxies([]string{"10.0.0.0/8"}) },
+		"SetTrustedHops":     func() { r.SetTrustedHops(1) },
+		"SetClientIPExtractor": func() {
+			r.SetClientIPExtractor(func(req *http.Request) string { return "" })
+		},
+	}
+
+	for op, call := range calls {
+		func() {
+			defer func() {
+				msg, _ := recover().(string)
+				if !strings.Contains(msg, "router: "+op+" called after the router started serving") {
+					t.Errorf("%s: expected a sealed-router panic, got %q", op, msg)
+				}
+			}()
+			call()
+		}()
+	}
+}
+
+func TestOnPanicHookPanicIsContained(t *testing.T) {
+	defer os.RemoveAll("./logs")
+
+	logger := &recordingLogger{}
+	r := newTestableRouter()
+	r.SetLogger(logger)
+
+	r.OnPanic(func(req *http.Request, recovered any, stack []byte) {
+		panic("hook exploded")
+	})
+	r.HandleFunc("/panic", "GET", func(w http.ResponseWriter, _ *http.Request, ctx *Context) {
+		panic("fail")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+	if !strings.Contains(strings.Join(logger.entries, "\n"), "OnPanic hook failed error=hook exploded") {
+		t.Errorf("expected the hook failure to be logged, got %v", logger.entries)
+	}
+}
+
 func TestPrefixSegmentMiddleware(t *testing.T) {
 	r := NewRouter().(*Router)
 	r.Prefix("/api")
@@ -176,18 +415,172 @@ func TestListenAndServe(t *testing.T) {
 		}
 	})
 
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := probe.Addr().String()
+	_ = probe.Close()
+
+	r.TerminalOutput(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
 	go func() {
-		time.Sleep(100 * time.Millisecond)
-		_, err := http.Get("http://localhost:8089/ping")
+		done <- r.Serve(ctx, Listeners{{Listen: addr, Domain: addr}})
+	}()
+
+	var body []byte
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get("http://" + addr + "/ping")
+		if err == nil {
+			body, _ = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if string(body) != "pong" {
+		t.Fatalf("expected pong, got %q", body)
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
 		if err != nil {
-			return
+			t.Fatalf("Serve returned %v", err)
 		}
-	}()
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return after the context was cancelled")
+	}
+
+	if _, err := http.Get("http://" + addr + "/ping"); err == nil {
+		t.Fatal("expected the server to be closed after shutdown")
+	}
+}
+
+func TestServeReturnsFirstServerError(t *testing.T) {
+	logger := &recordingLogger{}
+	r := NewRouter().(*Router)
+	r.TerminalOutput(false)
+	r.SetLogger(logger)
+	r.HandleFunc("/ping", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte("pong"))
+	})
+
+	live, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	broken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	_ = broken.Close()
 
+	listeners := Listeners{{Listen: live.Addr().String()}, {Listen: broken.Addr().String()}}
+	done := make(chan error, 1)
 	go func() {
-		r.ListenAndServe(8089)
+		done <- r.serveBound(context.Background(), listeners, []int{0, 0}, [][]net.Listener{{live}, {broken}}, make([]*tls.Config, 2))
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "server error on "+broken.Addr().String()) {
+			t.Fatalf("expected the failing listener's error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return after a server failed")
+	}
+
+	if _, err := http.Get("http://" + live.Addr().String() + "/ping"); err == nil {
+		t.Fatal("expected the healthy server to be shut down")
+	}
+
+	logs := strings.Join(logger.entries, "\n")
+	if !strings.Contains(logs, "ERROR server error addr="+broken.Addr().String()+" error=") {
+		t.Fatalf("expected a structured server error through the custom logger without terminal output, got:\n%s", logs)
+	}
+}
+
+func TestBindListenersSharesOnePort(t *testing.T) {
+	if !reusePortSupported {
+		t.Skip("SO_REUSEPORT is not available on " + runtime.GOOS)
+	}
+
+	r := NewRouter().(*Router)
+	bound, err := r.bindListeners("127.0.0.1:0", 3)
+	if err != nil {
+		t.Fatalf("bind failed: %v", err)
+	}
+	defer func() {
+		for _, l := range bound {
+			_ = l.Close()
+		}
 	}()
-	time.Sleep(300 * time.Millisecond)
+
+	if len(bound) != 3 {
+		t.Fatalf("expected 3 worker listeners, got %d", len(bound))
+	}
+	for _, l := range bound[1:] {
+		if l.Addr().String() != bound[0].Addr().String() {
+			t.Fatalf("expected workers to share %s, got %s", bound[0].Addr(), l.Addr())
+		}
+	}
+}
+
+func TestMultiListenAndServeErrReturnsErrors(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.TerminalOutput(false)
+
+	if err := r.MultiListenAndServeErr(Listeners{{Listen: "localhost"}}); err == nil || !strings.Contains(err.Error(), "invalid listen address") {
+		t.Fatalf("expected an invalid address error, got %v", err)
+	}
+	if err := r.MultiListenAndServeErr(Listeners{{Listen: "localhost:http-alt"}}); err == nil || !strings.Contains(err.Error(), "invalid port format") {
+		t.Fatalf("expected an invalid port error, got %v", err)
+	}
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = busy.Close() }()
+
+	err = r.MultiListenAndServeErr(Listeners{{Listen: busy.Addr().String()}})
+	if err == nil || !strings.Contains(err.Error(), "failed to listen on "+busy.Addr().String()) {
+		t.Fatalf("expected a bind error, got %v", err)
+	}
+}
+
+func TestWorkerCount(t *testing.T) {
+	prev := runtime.GOMAXPROCS(1)
+	defer runtime.GOMAXPROCS(prev)
+
+	r := NewRouter().(*Router)
+	r.TuneRuntime(false)
+
+	if got := r.workerCount(); got != 1 {
+		t.Fatalf("expected workers to follow GOMAXPROCS when runtime tuning is off, got %d", got)
+	}
+
+	r.Workers(3)
+	if got := r.workerCount(); got != 3 {
+		t.Fatalf("expected 3 workers, got %d", got)
+	}
+	if got := runtime.GOMAXPROCS(0); got != 1 {
+		t.Fatalf("expected GOMAXPROCS to be left untouched, got %d", got)
+	}
+
+	r.Workers(0)
+	r.TuneRuntime(true)
+	if got := r.workerCount(); got != runtime.NumCPU() {
+		t.Fatalf("expected the default to use every CPU, got %d", got)
+	}
+	if got := runtime.GOMAXPROCS(0); got != runtime.NumCPU() {
+		t.Fatalf("expected runtime tuning to raise GOMAXPROCS to %d, got %d", runtime.NumCPU(), got)
+	}
+	debug.SetGCPercent(100)
 }
 
 func TestEnableProfiling(t *testing.T) {
@@ -224,3 +617,948 @@ func TestRouteGrouping(t *testing.T) {
 		t.Errorf("expected body 'ok', got '%s'", w.Body.String())
 	}
 }
+
+func TestAutoOptionsRouteCORSMeta(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	r.HandleFuncMeta("/orders", "GET POST", RouteMeta{
+		CORS: &CORSOptions{
+			AllowedOrigins: []string{"https://shop.example.com"},
+			AllowedMethods: []string{"GET", "POST"},
+			AllowedHeaders: []string{"Content-Type"},
+		},
+	}, handlerWithID("orders"))
+
+	r.HandleFuncMeta("/reports/<id:isDigits>", "GET", RouteMeta{
+		CORS: &CORSOptions{
+			AllowedOrigins: []string{"https://shop.example.com"},
+			AllowedMethods: []string{"GET"},
+		},
+	}, handlerWithID("report"))
+
+	tests := []struct {
+		path    string
+		methods string
+		allow   string
+	}{
+		{"/orders", "GET, POST", "GET, HEAD, POST, OPTIONS"},
+		{"/reports/42", "GET", "GET, HEAD, OPTIONS"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+		req.Header.Set("Origin", "https://shop.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s: expected 204, got %d", tt.path, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Methods"); got != tt.methods {
+			t.Errorf("%s: Access-Control-Allow-Methods = %q, want %q", tt.path, got, tt.methods)
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s: Allow = %q, want %q", tt.path, got, tt.allow)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://shop.example.com" {
+			t.Errorf("%s: unexpected Access-Control-Allow-Origin %q", tt.path, got)
+		}
+	}
+}
+
+func dbCheck() error {
+	return fmt.Errorf("connection refused")
+}
+
+func cacheCheck() error {
+	return nil
+}
+
+func TestHealthChecks(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.Ready()
+	r.Health("/healthz", HealthCheck{Name: "database", Check: dbCheck}, HealthCheck{Name: "cache", Check: cacheCheck})
+
+	req := httptest.NewRequest(http.MethodGet, "/ready", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("expected /ready to return 200 ok, got %d %q", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+
+	var body struct {
+		Failing []string `json:"failing"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if len(body.Failing) != 1 || body.Failing[0] != "database" {
+		t.Fatalf("unexpected failing checks: %v", body.Failing)
+	}
+
+	r.SetReady(false)
+	req = httptest.NewRequest(http.MethodGet, "/ready", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while shutting down, got %d", w.Code)
+	}
+}
+
+func TestHandleFuncMulti(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	r.HandleFuncMulti([]string{"/login", "/signin", "/a/<id:[0-9a-f]+>", "/b/<id:[0-9a-f]+>"}, "GET", handlerWithID("shared"))
+
+	for _, path := range []string{"/login", "/signin", "/a/ff", "/b/00"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Body.String() != "shared" {
+			t.Errorf("%s: got %d %q", path, w.Code, w.Body.String())
+		}
+	}
+
+	if len(r.regexCache) != 1 {
+		t.Fatalf("expected identical patterns to share one compiled regexp, got %d", len(r.regexCache))
+	}
+}
+
+func TestShutdownDeadlineInHandler(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	var (
+		deadline time.Time
+		ok       bool
+	)
+	r.HandleFunc("/export", "GET", func(w http.ResponseWriter, _ *http.Request, ctx *Context) {
+		deadline, ok = ctx.ShutdownDeadline()
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/export", nil))
+	if ok {
+		t.Fatalf("expected no shutdown deadline while running")
+	}
+
+	want := time.Now().Add(shutdownTimeout)
+	r.markShutdown(want)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/export", nil))
+	if !ok || !deadline.Equal(want) {
+		t.Fatalf("expected deadline %v during shutdown, got %v (ok=%v)", want, deadline, ok)
+	}
+	if r.IsReady() {
+		t.Fatalf("expected router to report not ready during shutdown")
+	}
+}
+
+func TestSubmatchCapturesAsParams(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	var params map[string]string
+	r.HandleFunc(`/api/<ver:v(?P<major>\d+)\.(\d+)>/users`, "GET", func(w http.ResponseWriter, _ *http.Request, ctx *Context) {
+		params = ctx.ParamMap()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2.7/users", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	want := map[string]string{"ver": "v2.7", "major": "2", "ver.2": "7"}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("param %q = %q, want %q (all=%v)", k, params[k], v, params)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/vx.7/users", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected a non-matching segment to 404, got %d", w.Code)
+	}
+}
+
+func TestValidateReportsAllBadPatterns(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.SetLogger(&terminalLogger{out: io.Discard})
+
+	r.Ready()
+	r.HandleFunc("/ok/<id:isDigits>", "GET", handlerWithID("ok"))
+	r.HandleFunc("/empty/<id:>", "GET", handlerWithID("empty"))
+	r.HandleFunc("/regex/<id:([a-z>", "GET", handlerWithID("regex"))
+	r.HandleFunc("/range/<n:int(5,1)>", "GET", handlerWithID("range"))
+
+	err := r.Validate()
+	if err == nil {
+		t.Fatalf("expected Validate to report errors")
+	}
+
+	msg := err.Error()
+	for _, want := range []string{"/empty/<id:>", "/regex/<id:([a-z>", "/range/<n:int(5,1)>"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected error to mention %q, got:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "/ok/") {
+		t.Errorf("valid route reported as invalid:\n%s", msg)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ok/1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected valid route to keep working, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"failing":["routes"]`) {
+		t.Fatalf("expected /ready to fail on invalid routes, got %d %q", w.Code, w.Body.String())
+	}
+
+	if serveErr := r.Serve(context.Background(), Listeners{{Listen: "127.0.0.1:0"}}); serveErr == nil || serveErr.Error() != msg {
+		t.Fatalf("expected Serve to return the Validate error, got %v", serveErr)
+	}
+}
+
+func TestHandleFuncErr(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	if err := r.HandleFuncErr("/items/<id:isDigits>", "GET", handlerWithID("items")); err != nil {
+		t.Fatalf("unexpected error for valid route: %v", err)
+	}
+	if err := r.HandleFuncErr("/bad", "FETCH", handlerWithID("bad")); !errors.Is(err, ErrInvalidMethod) {
+		t.Fatalf("expected ErrInvalidMethod, got %v", err)
+	}
+	for _, methods := range []string{"", " , "} {
+		if err := r.HandleFuncErr("/e", methods, handlerWithID("e")); !errors.Is(err, ErrInvalidMethod) {
+			t.Fatalf("methods %q: expected ErrInvalidMethod, got %v", methods, err)
+		}
+	}
+	if err := r.HandleFuncErr("", "GET", handlerWithID("empty")); !errors.Is(err, ErrEmptyPattern) {
+		t.Fatalf("expected ErrEmptyPattern, got %v", err)
+	}
+	if err := r.HandleFuncErr("/regex/<id:([a-z>", "GET", handlerWithID("regex")); err == nil {
+		t.Fatalf("expected error for bad regex")
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("HandleFuncErr should not record errors for Validate, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected registered route to be served, got %d", w.Code)
+	}
+}
+
+func TestMalformedPatternsReturnRouteError(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	tests := []struct {
+		route   string
+		segment string
+		empty   bool
+	}{
+		{"/users/<id:>", "<id:>", true},
+		{"/files/<name:([a-z>/raw", "<name:([a-z>", false},
+		{"/posts/{slug:[}", "{slug:[}", false},
+	}
+
+	for _, tt := range tests {
+		err := r.HandleFuncErr(tt.route, "GET", handlerWithID("x"))
+
+		var re *RouteError
+		if !errors.As(err, &re) {
+			t.Fatalf("%s: expected *RouteError, got %T %v", tt.route, err, err)
+		}
+		if re.Route != tt.route || re.Segment != tt.segment {
+			t.Errorf("%s: got route %q segment %q, want segment %q", tt.route, re.Route, re.Segment, tt.segment)
+		}
+		if errors.Is(err, ErrEmptyPattern) != tt.empty {
+			t.Errorf("%s: errors.Is(ErrEmptyPattern) = %v, want %v", tt.route, !tt.empty, tt.empty)
+		}
+		if !strings.Contains(err.Error(), tt.segment) {
+			t.Errorf("%s: message %q does not name the segment", tt.route, err.Error())
+		}
+	}
+
+	r.HandleFunc("/users/<id:>", "GET", handlerWithID("x"))
+	if err := r.Validate(); !errors.Is(err, ErrEmptyPattern) {
+		t.Errorf("expected Validate to report the empty pattern, got %v", err)
+	}
+}
+
+func TestRouteContentTypeDefault(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	r.HandleFuncMeta("/feed", "GET", RouteMeta{ContentType: "application/rss+xml"}, func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte("<rss/>"))
+	})
+
+	api := r.Group("/api").ContentType("application/json")
+	api.HandleFunc("/users/<id:isDigits>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte(`{"id":1}`))
+	})
+	api.HandleFunc("/export", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		w.Header().Set("Content-Type", "text/csv")
+		_, _ = w.Write([]byte("id\n1\n"))
+	})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/feed", "application/rss+xml"},
+		{"/api/users/1", "application/json"},
+		{"/api/export", "text/csv"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Type"); got != tt.want {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestOnCompleteSeesFinalStatus(t *testing.T) {
+	defer os.RemoveAll("./logs")
+
+	r := NewRouter().(*Router)
+	r.TerminalOutput(false)
+
+	var statuses []int
+	audit := func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			ctx.OnComplete(func() {
+				statuses = append(statuses, ctx.Status())
+			})
+			next(w, req, ctx)
+		}
+	}
+	r.Use(audit)
+
+	r.HandleFunc("/created", "POST", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	r.HandleFunc("/implicit", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	r.HandleFunc("/panic", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		panic("boom")
+	})
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodPost, "/created"},
+		{http.MethodGet, "/implicit"},
+		{http.MethodGet, "/panic"},
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tc.method, tc.path, nil))
+	}
+
+	want := []int{http.StatusCreated, http.StatusOK, http.StatusInternalServerError}
+	if len(statuses) != len(want) {
+		t.Fatalf("hooks ran %d times, want %d", len(statuses), len(want))
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Errorf("hook %d saw status %d, want %d", i, statuses[i], want[i])
+		}
+	}
+}
+
+func TestOnCompleteHookPanicIsContained(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := NewRouter().(*Router)
+	r.TerminalOutput(false)
+	r.SetErrorLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	var ran []string
+	var seen *Context
+	r.HandleFunc("/done", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		seen = ctx
+		ctx.OnComplete(func() { ran = append(ran, "first") })
+		ctx.OnComplete(func() { panic("hook exploded") })
+		ctx.OnComplete(func() { ran = append(ran, "last") })
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/done", nil))
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if len(ran) != 2 || ran[0] != "last" || ran[1] != "first" {
+		t.Fatalf("expected the other hooks to run, got %v", ran)
+	}
+	if !strings.Contains(buf.String(), "hook exploded") {
+		t.Fatalf("expected the hook panic to be logged, got %q", buf.String())
+	}
+	if !seen.released {
+		t.Fatal("expected the context to be returned to the pool")
+	}
+}
+
+type plainResponseWriter struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (p *plainResponseWriter) Header() http.Header         { return p.header }
+func (p *plainResponseWriter) Write(b []byte) (int, error) { return p.body.Write(b) }
+func (p *plainResponseWriter) WriteHeader(int)             {}
+
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (r *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.readFrom = true
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func TestResponseWriterCapabilities(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.TerminalOutput(false)
+
+	var flusher, hijacker, pusher bool
+	var flushErr error
+	r.HandleFunc("/caps", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+		_, pusher = w.(http.Pusher)
+		flushErr = http.NewResponseController(w).Flush()
+	})
+	r.HandleFunc("/copy", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		n, _ := io.Copy(w, struct{ io.Reader }{strings.NewReader("copied body")})
+		ctx.OnComplete(func() {
+			if ctx.Status() != http.StatusOK || n != int64(len("copied body")) || ctx.writer.written != n {
+				t.Errorf("expected ReadFrom to record status and bytes, got %d %d %d", ctx.Status(), n, ctx.writer.written)
+			}
+		})
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/caps", nil))
+	if !flusher || hijacker || pusher || flushErr != nil {
+		t.Fatalf("recorder: flusher=%v hijacker=%v pusher=%v flush=%v", flusher, hijacker, pusher, flushErr)
+	}
+
+	r.ServeHTTP(&plainResponseWriter{header: http.Header{}}, httptest.NewRequest(http.MethodGet, "/caps", nil))
+	if flusher || hijacker || pusher || flushErr == nil {
+		t.Fatalf("plain writer: flusher=%v hijacker=%v pusher=%v flush=%v", flusher, hijacker, pusher, flushErr)
+	}
+
+	rf := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r.ServeHTTP(rf, httptest.NewRequest(http.MethodGet, "/copy", nil))
+	if !rf.readFrom || rf.Body.String() != "copied body" {
+		t.Fatalf("expected io.Copy to reach the wrapped ReadFrom, got %v %q", rf.readFrom, rf.Body.String())
+	}
+}
+
+func TestToHTTP(t *testing.T) {
+	defer os.RemoveAll("./logs")
+
+	r := NewRouter().(*Router)
+	r.TerminalOutput(false)
+	r.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			ctx.Set("user", "alice")
+			next(w, req, ctx)
+		}
+	})
+
+	recovered := false
+	r.Recovery(func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		recovered = true
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	h := r.ToHTTP(func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte(ctx.Get("user").(string)))
+	})
+	panicking := r.ToHTTP(func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/anything", nil))
+	if w.Body.String() != "alice" {
+		t.Fatalf("expected global middleware to run, body = %q", w.Body.String())
+	}
+	if !r.sealed.Load() {
+		t.Fatal("expected a ToHTTP handler to seal the router")
+	}
+
+	w = httptest.NewRecorder()
+	panicking(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !recovered || w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected panic to be handled by recovery, recovered=%v code=%d", recovered, w.Code)
+	}
+}
+
+func TestToHTTPWrapsOnce(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.TerminalOutput(false)
+
+	builds := 0
+	r.Use(func(next HandlerFunc) HandlerFunc {
+		builds++
+		return next
+	})
+
+	h := r.ToHTTP(func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte(ctx.Get("tag").(string)))
+	})
+
+	r.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			ctx.Set("tag", "late")
+			next(w, req, ctx)
+		}
+	})
+
+	before := builds
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Body.String() != "late" {
+			t.Fatalf("expected middleware added after ToHTTP to run, body = %q", w.Body.String())
+		}
+	}
+	if builds != before {
+		t.Fatalf("expected the chain to be built once, got %d extra builds", builds-before)
+	}
+}
+
+func TestStaticAndRoutesShareMountPrefix(t *testing.T) {
+	dir := "files/overlap"
+	_ = os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "status"), []byte("static status"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	get := func(r *Router, path string) (int, string) {
+		w := httptest.NewRecorder()
+		r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	newRouter := func(order StaticPrecedence) *Router {
+		r := NewRouter().(*Router)
+		r.Static(dir, "/assets")
+		r.StaticPrecedence(order)
+		r.HandleFunc("/assets/status", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			_, _ = w.Write([]byte("route status"))
+		})
+		r.HandleFunc("/assets/health", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			_, _ = w.Write([]byte("route health"))
+		})
+		return r
+	}
+
+	tests := []struct {
+		order StaticPrecedence
+		path  string
+		code  int
+		body  string
+	}{
+		{StaticFirst, "/assets/app.js", http.StatusOK, "console.log(1)"},
+		{StaticFirst, "/assets/status", http.StatusOK, "static status"},
+		{StaticFirst, "/assets/health", http.StatusOK, "route health"},
+		{StaticFirst, "/assets/missing.css", http.StatusNotFound, ""},
+		{RoutesFirst, "/assets/app.js", http.StatusOK, "console.log(1)"},
+		{RoutesFirst, "/assets/status", http.StatusOK, "route status"},
+		{RoutesFirst, "/assets/health", http.StatusOK, "route health"},
+		{RoutesFirst, "/assets/missing.css", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		code, body := get(newRouter(tt.order), tt.path)
+		if code != tt.code {
+			t.Errorf("order=%d %s: status = %d, want %d", tt.order, tt.path, code, tt.code)
+		}
+		if tt.body != "" && body != tt.body {
+			t.Errorf("order=%d %s: body = %q, want %q", tt.order, tt.path, body, tt.body)
+		}
+	}
+}
+
+func TestPreRouteRewritesAndShortCircuits(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	r.PreRoute(func(w http.ResponseWriter, req *http.Request) bool {
+		if req.Host == "blocked.example.com" {
+			http.Error(w, "unknown tenant", http.StatusNotFound)
+			return false
+		}
+		return true
+	})
+	r.PreRoute(func(w http.ResponseWriter, req *http.Request) bool {
+		if tenant, _, ok := strings.Cut(req.Host, "."); ok && tenant != "www" {
+			req.URL.Path = "/tenants/" + tenant + req.URL.Path
+		}
+		return true
+	})
+
+	r.HandleFunc("/tenants/<tenant>/home", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		tenant, _ := ctx.Param("tenant")
+		_, _ = w.Write([]byte("tenant " + tenant))
+	})
+
+	for _, h := range []http.Handler{r, r.Handler()} {
+		req := httptest.NewRequest(http.MethodGet, "http://acme.example.com/home", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Body.String() != "tenant acme" {
+			t.Fatalf("expected rewritten route to match, got %d %q", w.Code, w.Body.String())
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "http://blocked.example.com/home", nil)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "unknown tenant") {
+			t.Fatalf("expected pre-route hook to short-circuit, got %d %q", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestNotFoundBody(t *testing.T) {
+	r := NewRouter().(*Router)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusNotFound || w.Body.String() != "404 page not found" {
+		t.Fatalf("unexpected default 404: %d %q", w.Code, w.Body.String())
+	}
+
+	r = NewRouter().(*Router)
+	r.NotFoundJSON()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected JSON 404: %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] != "not found" {
+		t.Fatalf("unexpected JSON 404 body %q: %v", w.Body.String(), err)
+	}
+
+	r = NewRouter().(*Router)
+	r.NotFoundBody([]byte("<h1>Gone fishing</h1>"), "text/html; charset=utf-8")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Body.String() != "<h1>Gone fishing</h1>" || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected custom 404: %q %q", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+
+	r = NewRouter().(*Router)
+	r.NotFoundBody([]byte("<h1>Gone fishing</h1>"), "text/html; charset=utf-8")
+	r.NotFound(func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("NotFound handler should take precedence, got %d", w.Code)
+	}
+}
+
+func TestFailedValidationIsNotFoundNotMethodNotAllowed(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.HandleFunc(`/user/<id:\d+>`, "GET", handlerWithID("user"))
+	r.HandleFunc("/item/<id:isDigits>", "GET", handlerWithID("item by id"))
+	r.HandleFunc("/item/<slug:isSlug>", "POST", handlerWithID("item by slug"))
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{http.MethodGet, "/user/42", http.StatusOK, ""},
+		{http.MethodGet, "/user/abc", http.StatusNotFound, ""},
+		{http.MethodPost, "/user/abc", http.StatusNotFound, ""},
+		{http.MethodOptions, "/user/abc", http.StatusNotFound, ""},
+		{http.MethodPost, "/user/42", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{http.MethodPut, "/item/abc", http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{http.MethodPut, "/item/7", http.StatusMethodNotAllowed, "GET, HEAD, POST, OPTIONS"},
+		{http.MethodPut, "/item/Not_A_Slug", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+
+		if w.Code != tc.status || w.Header().Get("Allow") != tc.allow {
+			t.Errorf("%s %s: got %d Allow=%q, want %d Allow=%q", tc.method, tc.path, w.Code, w.Header().Get("Allow"), tc.status, tc.allow)
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+			w.Header().Set("X-Middleware", "1")
+			next(w, req, ctx)
+		}
+	})
+	r.HandleFunc("/api/users/<id:isDigits>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		Text(w, http.StatusOK, "user")
+	})
+	r.HandleFunc("/about", "POST", func(w http.ResponseWriter, req *http.Request, ctx *Context) {})
+	r.Fallback("/", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		Text(w, http.StatusOK, "index.html")
+	})
+	r.Fallback("/api/", nil)
+	r.Fallback("docs", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		Text(w, http.StatusOK, "docs index")
+	})
+	r.NotFound(func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		Text(w, http.StatusNotFound, "not found")
+	})
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/dashboard/settings", http.StatusOK, "index.html"},
+		{http.MethodGet, "/api/users/7", http.StatusOK, "user"},
+		{http.MethodGet, "/api/orders", http.StatusNotFound, "not found"},
+		{http.MethodGet, "/api", http.StatusNotFound, "not found"},
+		{http.MethodGet, "/apidocs", http.StatusOK, "index.html"},
+		{http.MethodGet, "/docs/intro", http.StatusOK, "docs index"},
+		{http.MethodPost, "/dashboard", http.StatusNotFound, "not found"},
+		{http.MethodGet, "/about", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+
+		if w.Code != tc.status || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("%s %s: got %d %q, want %d %q", tc.method, tc.path, w.Code, w.Body.String(), tc.status, tc.body)
+		}
+		if tc.body == "index.html" && w.Header().Get("X-Middleware") != "1" {
+			t.Errorf("%s %s: expected global middleware to wrap the fallback", tc.method, tc.path)
+		}
+	}
+}
+
+func TestListenerHandlerSelection(t *testing.T) {
+	public := NewRouter().(*Router)
+	public.HandleFunc("/info", "GET", handlerWithID("public"))
+
+	admin := NewRouter().(*Router)
+	admin.HandleFunc("/info", "GET", handlerWithID("admin"))
+
+	get := func(ln Listener) string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen failed: %v", err)
+		}
+
+		srv := public.newServer(ln)
+		go func() {
+			_ = public.serveListener(srv, l, nil)
+		}()
+		defer func() {
+			_ = srv.Close()
+		}()
+
+		resp, err := http.Get("http://" + l.Addr().String() + "/info")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := get(Listener{Listen: "127.0.0.1:0"}); got != "public" {
+		t.Errorf("listener without handler should use the shared router, got %q", got)
+	}
+	if got := get(Listener{Listen: "127.0.0.1:0", Handler: admin.Handler()}); got != "admin" {
+		t.Errorf("listener handler should take precedence, got %q", got)
+	}
+}
+
+func TestAnyRoutesMatchEveryMethod(t *testing.T) {
+	r := newTestableRouter()
+
+	handler := func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		w.Header().Set("X-Method", req.Method)
+		w.WriteHeader(http.StatusOK)
+	}
+	r.HandleFunc("/any", "ANY", handler)
+	r.HandleFunc("/any/<id:isDigits>", "ANY", handler)
+	r.HandleFunc("/get-only", "GET", handler)
+
+	for _, path := range []string{"/any", "/any/42"} {
+		for _, method := range []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS", "PROPFIND"} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+
+			if w.Code != http.StatusOK || w.Header().Get("X-Method") != method {
+				t.Errorf("%s %s: got status %d, handler saw %q", method, path, w.Code, w.Header().Get("X-Method"))
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PROPFIND", "/get-only", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for an unknown method on a GET route, got %d", w.Code)
+	}
+}
+
+func TestHeadRequestsSuppressBody(t *testing.T) {
+	r := newTestableRouter()
+
+	handler := func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Seen-Method", req.Method)
+		_, _ = w.Write([]byte("hello world"))
+	}
+	r.HandleFunc("/plain", "GET", handler)
+	r.HandleFunc("/items/<id:isDigits>", "GET", handler)
+	mw := r.Group("/mw")
+	mw.Use(GetHead())
+	mw.HandleFunc("/items", "GET", handler)
+
+	for path, seen := range map[string]string{
+		"/plain":    "HEAD",
+		"/items/42": "HEAD",
+		"/mw/items": "GET",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodHead, path, nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, w.Code)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("%s: expected empty body, got %q", path, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Length"); got != "11" {
+			t.Errorf("%s: Content-Length = %q, want %q", path, got, "11")
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/plain" {
+			t.Errorf("%s: Content-Type = %q, want text/plain", path, got)
+		}
+		if got := w.Header().Get("X-Seen-Method"); got != seen {
+			t.Errorf("%s: handler saw method %q, want %q", path, got, seen)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plain", nil))
+	if w.Body.String() != "hello world" {
+		t.Errorf("expected GET body to be untouched, got %q", w.Body.String())
+	}
+}
+
+func TestMethodHelpersRegisterSingleMethods(t *testing.T) {
+	r := newTestableRouter()
+
+	for method, register := range map[string]func(string, HandlerFunc){
+		"GET":    r.GET,
+		"POST":   r.POST,
+		"PUT":    r.PUT,
+		"DELETE": r.DELETE,
+		"PATCH":  r.PATCH,
+	} {
+		body := method
+		register("/items", handlerWithID(body))
+		register("/items/<id:isDigits>", handlerWithID(body+" one"))
+	}
+
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE", "PATCH"} {
+		for path, want := range map[string]string{"/items": method, "/items/7": method + " one"} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+
+			if w.Code != http.StatusOK || w.Body.String() != want {
+				t.Errorf("%s %s: got %d %q, want 200 %q", method, path, w.Code, w.Body.String(), want)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/items", nil))
+	if got := w.Header().Get("Allow"); got != "GET, HEAD, POST, PUT, DELETE, PATCH, OPTIONS" {
+		t.Errorf("Allow = %q", got)
+	}
+
+	if err := r.Validate(); err != nil {
+		t.Errorf("expected no registration errors, got %v", err)
+	}
+}
+
+func TestRejectDotSegments(t *testing.T) {
+	newRouter := func(reject bool) *Router {
+		r := NewRouter().(*Router)
+		r.RejectDotSegments(reject)
+		r.HandleFunc("/files/<name>", "GET", handlerWithID("file"))
+		r.HandleFunc("/etc/passwd", "GET", handlerWithID("secret"))
+		return r
+	}
+
+	serve := func(h http.Handler, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := serve(newRouter(false), "/files/../etc/passwd"); w.Code == http.StatusBadRequest {
+		t.Fatalf("dot segments must be allowed by default")
+	}
+
+	r := newRouter(true)
+
+	for _, h := range []http.Handler{r, r.Handler()} {
+		for _, path := range []string{"/files/../etc/passwd", "/..", "/files/%2e%2e/etc/passwd"} {
+			if w := serve(h, path); w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d", path, w.Code)
+			}
+		}
+		for _, path := range []string{"/files/..name", "/files/a..b"} {
+			if w := serve(h, path); w.Code != http.StatusOK {
+				t.Errorf("%s: expected 200, got %d", path, w.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package router
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type SessionStore interface {
+	Get(id string) (map[string]any, error)
+	Set(id string, values map[string]any, ttl time.Duration) error
+	Delete(id string) error
+}
+
+type SessionOptions struct {
+	CookieName string
+	Path       string
+	Domain     string
+	MaxAge     int
+	Secure     bool
+	HttpOnly   bool
+	SameSite   http.SameSite
+	Key        []byte
+}
+
+type SessionData struct {
+	id        string
+	values    map[string]any
+	isNew     bool
+	changed   bool
+	destroyed bool
+}
+
+func (s *SessionData) ID() string {
+	return s.id
+}
+
+func (s *SessionData) Get(key string) any {
+	return s.values[key]
+}
+
+func (s *SessionData) Set(key string, value any) {
+	s.values[key] = value
+	s.changed = true
+}
+
+func (s *SessionData) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+func (s *SessionData) Destroy() {
+	s.values = map[string]any{}
+	s.destroyed = true
+}
+
+func GetSession(ctx *Context) *SessionData {
+	s, _ := GetTyped[*SessionData](ctx, "session")
+	return s
+}
+
+func Session(store SessionStore, opts SessionOptions) Middleware {
+	if opts.CookieName == "" {
+		opts.CookieName = "session_id"
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+
+	ttl := time.Duration(opts.MaxAge) * time.Second
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, c *Context) {
+			s := loadSession(store, opts, r)
+			c.Set("session", s)
+
+			sw := &sessionWriter{ResponseWriter: w, session: s, opts: opts}
+			next(sw, r, c)
+			sw.writeCookie()
+
+			switch {
+			case s.destroyed:
+				if !s.isNew {
+					_ = store.Delete(s.id)
+				}
+			case s.changed || !s.isNew:
+				if err := store.Set(s.id, s.values, ttl); err != nil {
+					c.Logger().Error("failed to save session", "error", err)
+				}
+			}
+		}
+	}
+}
+
+func loadSession(store SessionStore, opts SessionOptions, r *http.Request) *SessionData {
+	var id string
+	if opts.Key != nil {
+		id, _ = SignedCookie(r, opts.CookieName, opts.Key)
+	} else {
+		id = Cookie(r, opts.CookieName)
+	}
+
+	if id != "" {
+		if values, err := store.Get(id); err == nil && values != nil {
+			return &SessionData{id: id, values: values}
+		}
+	}
+
+	return &SessionData{id: newSessionID(), values: map[string]any{}, isNew: true}
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type sessionWriter struct {
+	http.ResponseWriter
+	session *SessionData
+	opts    SessionOptions
+	written bool
+}
+
+func (sw *sessionWriter) writeCookie() {
+	if sw.written {
+		return
+	}
+	sw.written = true
+
+	s := sw.session
+	cookie := &http.Cookie{
+		Name:     sw.opts.CookieName,
+		Value:    s.id,
+		Path:     sw.opts.Path,
+		Domain:   sw.opts.Domain,
+		MaxAge:   sw.opts.MaxAge,
+		Secure:   sw.opts.Secure,
+		HttpOnly: sw.opts.HttpOnly,
+		SameSite: sw.opts.SameSite,
+	}
+
+	switch {
+	case s.destroyed:
+		if s.isNew {
+			return
+		}
+		cookie.Value = ""
+		cookie.MaxAge = -1
+		SetCookie(sw.ResponseWriter, cookie)
+		return
+	case s.isNew && !s.changed:
+		return
+	case !s.isNew && sw.opts.MaxAge <= 0:
+		return
+	}
+
+	if sw.opts.Key != nil {
+		SetSignedCookie(sw.ResponseWriter, cookie, sw.opts.Key)
+	} else {
+		SetCookie(sw.ResponseWriter, cookie)
+	}
+}
+
+func (sw *sessionWriter) WriteHeader(status int) {
+	sw.writeCookie()
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *sessionWriter) Write(b []byte) (int, error) {
+	sw.writeCookie()
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *sessionWriter) Flush() {
+	sw.writeCookie()
+	if fl, ok := sw.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+func (sw *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := sw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("hijacker not supported")
+}
+
+func (sw *sessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+type memorySession struct {
+	values  map[string]any
+	expires time.Time
+}
+
+// Sessions saved without a TTL (browser-session cookies) are kept for
+// memorySessionIdleTTL after their last save, and expired entries are swept
+// from the map at most once per memorySweepInterval.
+const (
+	memorySessionIdleTTL = 24 * time.Hour
+	memorySweepInterval  = time.Minute
+)
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]memorySession)}
+}
+
+func (m *MemoryStore) Get(id string) (map[string]any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(s.expires) {
+		delete(m.sessions, id)
+		return nil, nil
+	}
+	return copyValues(s.values), nil
+}
+
+func (m *MemoryStore) Set(id string, values map[string]any, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = memorySessionIdleTTL
+	}
+	now := time.Now()
+
+	m.mu.Lock()
+	m.sessions[id] = memorySession{values: copyValues(values), expires: now.Add(ttl)}
+	m.sweep(now)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < memorySweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for id, s := range m.sessions {
+		if now.After(s.expires) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	return nil
+}
+
+func copyValues(values map[string]any) map[string]any {
+	out := make(map[string]any, len(values))
+	for k, v := range values {
+		out[k] = v
+	}
+	return out
+}
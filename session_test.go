@@ -0,0 +1,130 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	store := NewMemoryStore()
+	key := []byte("session-key")
+
+	r := NewRouter().(*Router)
+	r.Use(Session(store, SessionOptions{
+		CookieName: "sid",
+		MaxAge:     3600,
+		Secure:     true,
+		HttpOnly:   true,
+		SameSite:   http.SameSiteStrictMode,
+		Key:        key,
+	}))
+
+	r.HandleFunc("/login", "POST", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		GetSession(ctx).Set("user", "alice")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.HandleFunc("/me", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		user, _ := GetSession(ctx).Get("user").(string)
+		_, _ = w.Write([]byte(user))
+	})
+	r.HandleFunc("/logout", "POST", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		GetSession(ctx).Destroy()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/me", nil))
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatalf("untouched new session must not set a cookie")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected session cookie, got %d", len(cookies))
+	}
+	c := cookies[0]
+	if c.Name != "sid" || !c.Secure || !c.HttpOnly || c.SameSite != http.SameSiteStrictMode || c.MaxAge != 3600 {
+		t.Fatalf("cookie options not applied: %+v", c)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(&http.Cookie{Name: "sid", Value: c.Value})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "alice" {
+		t.Fatalf("expected session value to persist, got %q", w.Body.String())
+	}
+
+	forged := httptest.NewRequest(http.MethodGet, "/me", nil)
+	forged.AddCookie(&http.Cookie{Name: "sid", Value: "forged"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, forged)
+	if w.Body.String() != "" {
+		t.Fatalf("forged cookie must not load a session, got %q", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(&http.Cookie{Name: "sid", Value: c.Value})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Fatalf("expected logout to expire the cookie, got %+v", cookies)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(&http.Cookie{Name: "sid", Value: c.Value})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "" {
+		t.Fatalf("destroyed session must not be loaded, got %q", w.Body.String())
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+
+	_ = store.Set("a", map[string]any{"k": 1}, 0)
+	_ = store.Set("b", map[string]any{"k": 2}, -1)
+	store.sessions["c"] = memorySession{values: map[string]any{"k": 3}, expires: time.Now().Add(-time.Hour)}
+
+	if v, _ := store.Get("a"); v["k"] != 1 {
+		t.Errorf("expected session a, got %v", v)
+	}
+	if v, _ := store.Get("c"); v != nil {
+		t.Errorf("expected expired session c to be gone, got %v", v)
+	}
+
+	_ = store.Delete("a")
+	if v, _ := store.Get("a"); v != nil {
+		t.Errorf("expected deleted session a to be gone, got %v", v)
+	}
+}
+
+func TestMemoryStoreSweepsExpiredSessions(t *testing.T) {
+	store := NewMemoryStore()
+
+	_ = store.Set("browser", map[string]any{"k": 1}, 0)
+	if exp := store.sessions["browser"].expires; exp.IsZero() || time.Until(exp) > memorySessionIdleTTL {
+		t.Fatalf("expected a session without TTL to expire after the idle TTL, got %v", exp)
+	}
+
+	for i := 0; i < 3; i++ {
+		store.sessions[fmt.Sprint("stale", i)] = memorySession{expires: time.Now().Add(-time.Hour)}
+	}
+
+	_ = store.Set("fresh", map[string]any{}, time.Hour)
+	if len(store.sessions) != 5 {
+		t.Fatalf("expected no sweep within the sweep interval, got %d sessions", len(store.sessions))
+	}
+
+	store.lastSweep = time.Now().Add(-memorySweepInterval)
+	_ = store.Set("fresh", map[string]any{}, time.Hour)
+	if len(store.sessions) != 2 {
+		t.Fatalf("expected expired sessions to be swept, got %d sessions", len(store.sessions))
+	}
+}
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type StaticOptions struct {
+	Index          string
+	DisableListing bool
+	MaxAge         time.Duration
+}
+
+type staticFileSystem struct {
+	fs             http.FileSystem
+	index          string
+	disableListing bool
+}
+
+func newStaticFileSystem(fs http.FileSystem, opts StaticOptions) http.FileSystem {
+	if opts.Index == "" && !opts.DisableListing {
+		return fs
+	}
+	return &staticFileSystem{fs: fs, index: opts.Index, disableListing: opts.DisableListing}
+}
+
+func (sfs *staticFileSystem) Open(name string) (http.File, error) {
+	if sfs.index != "" && path.Base(name) == "index.html" {
+		name = path.Join(path.Dir(name), sfs.index)
+	}
+
+	f, err := sfs.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sfs.disableListing {
+		return f, nil
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if !st.IsDir() {
+		return f, nil
+	}
+
+	index := sfs.index
+	if index == "" {
+		index = "index.html"
+	}
+
+	idx, err := sfs.fs.Open(strings.TrimSuffix(name, "/") + "/" + index)
+	if err != nil {
+		_ = f.Close()
+		return nil, os.ErrNotExist
+	}
+	_ = idx.Close()
+
+	return f, nil
+}
+
+func staticCache(next http.Handler, fs http.FileSystem, maxAge time.Duration) http.Handler {
+	cacheControl := "public, max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := req.URL.Path
+		if !strings.HasPrefix(name, "/") {
+			name = "/" + name
+		}
+
+		if f, err := fs.Open(name); err == nil {
+			if st, err := f.Stat(); err == nil && !st.IsDir() {
+				h := w.Header()
+				h.Set("Cache-Control", cacheControl)
+				h.Set("ETag", `W/"`+strconv.FormatInt(st.Size(), 16)+"-"+strconv.FormatInt(st.ModTime().UnixNano(), 16)+`"`)
+			}
+			_ = f.Close()
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
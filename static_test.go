@@ -0,0 +1,231 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeStaticFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		full := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(body), 0644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+	}
+}
+
+func TestStaticDirectoryListingControl(t *testing.T) {
+	dir := "files/listing"
+	defer os.RemoveAll(dir)
+
+	writeStaticFiles(t, dir, map[string]string{
+		"docs/readme.txt":  "readme",
+		"site/home.html":   "<h1>home</h1>",
+		"plain/index.html": "<h1>index</h1>",
+	})
+
+	get := func(r *Router, path string) (int, string) {
+		w := httptest.NewRecorder()
+		r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	listing := NewRouter().(*Router)
+	listing.Static(dir, "/files")
+	if code, body := get(listing, "/files/docs/"); code != http.StatusOK || !strings.Contains(body, "readme.txt") {
+		t.Errorf("expected default directory listing, got %d %q", code, body)
+	}
+
+	r := NewRouter().(*Router)
+	r.StaticWithOptions(dir, "/files", StaticOptions{DisableListing: true, Index: "home.html"})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/files/docs/", http.StatusNotFound, ""},
+		{"/files/docs/readme.txt", http.StatusOK, "readme"},
+		{"/files/site/", http.StatusOK, "<h1>home</h1>"},
+		{"/files/plain/", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		code, body := get(r, tt.path)
+		if code != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.path, code, tt.code)
+		}
+		if tt.body != "" && body != tt.body {
+			t.Errorf("%s: body = %q, want %q", tt.path, body, tt.body)
+		}
+	}
+}
+
+func TestStaticWithCacheSetsCacheHeadersAndBypassesNoCache(t *testing.T) {
+	dir := "files/cached"
+	defer os.RemoveAll(dir)
+
+	writeStaticFiles(t, dir, map[string]string{"app.3f9a.js": "console.log(1)"})
+
+	r := NewRouter().(*Router)
+	r.UseDefaults()
+	r.StaticWithCache(dir, "/assets", time.Hour)
+	h := r.Handler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/assets/app.3f9a.js", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != "console.log(1)" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("Cache-Control = %q, want %q", got, "public, max-age=3600")
+	}
+	if w.Header().Get("Pragma") != "" {
+		t.Errorf("expected NoCache middleware not to touch static responses")
+	}
+	if w.Header().Get("Last-Modified") == "" {
+		t.Errorf("expected Last-Modified from http.FileServer")
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("expected an ETag")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/assets/app.3f9a.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching If-None-Match, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/assets/missing.js", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing asset, got %d", w.Code)
+	}
+	if strings.HasPrefix(w.Header().Get("Cache-Control"), "public") {
+		t.Errorf("missing assets must not be cached publicly")
+	}
+}
+
+func TestStaticRangeRequests(t *testing.T) {
+	dir := "files/ranges"
+	defer os.RemoveAll(dir)
+
+	writeStaticFiles(t, dir, map[string]string{"clip.txt": "0123456789"})
+
+	r := NewRouter().(*Router)
+	r.Use(DefaultCompress())
+	r.Static(dir, "/media")
+
+	req := httptest.NewRequest(http.MethodGet, "/media/clip.txt", nil)
+	req.Header.Set("Range", "bytes=0-4")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d", w.Code)
+	}
+	if w.Body.String() != "01234" {
+		t.Errorf("body = %q, want %q", w.Body.String(), "01234")
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 0-4/10" {
+		t.Errorf("Content-Range = %q", got)
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("range responses must not be compressed")
+	}
+}
+
+func TestStaticMountsAndOverlapWarnings(t *testing.T) {
+	defer os.RemoveAll("files/mounts")
+
+	logger := &recordingLogger{}
+	r := NewRouter().(*Router)
+	r.SetLogger(logger)
+
+	r.HandleFunc("/assets/<name>/meta", "GET", handlerWithID("meta"))
+	r.Static("files/mounts/b", "/media")
+	r.Static("files/mounts/a", "/assets")
+	r.Static("files/mounts/c", "/media")
+	r.HandleFunc("/media/status", "GET", handlerWithID("status"))
+
+	mounts := r.StaticMounts()
+	if strings.Join(mounts, ",") != "/assets/,/media/" {
+		t.Errorf("StaticMounts = %v", mounts)
+	}
+
+	all := strings.Join(logger.entries, "\n")
+	for _, want := range []string{
+		"WARN static mount overlaps a registered route mount=/assets/ route=/assets/<name>/meta",
+		"WARN static mount replaces an existing mount mount=/media/ dir=files/mounts/c",
+		"WARN route overlaps a static mount mount=/media/ route=/media/status",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expected log entry %q, got:\n%s", want, all)
+		}
+	}
+}
+
+func TestFileServesSingleFile(t *testing.T) {
+	dir := "files/single"
+	defer os.RemoveAll(dir)
+
+	writeStaticFiles(t, dir, map[string]string{
+		"robots.txt":               "User-agent: *\nDisallow:\n",
+		"sitemap.xml":              "<urlset/>",
+		".well-known/security.txt": "Contact: mailto:security@example.com\n",
+	})
+
+	r := NewRouter().(*Router)
+	r.File("/robots.txt", filepath.Join(dir, "robots.txt"))
+	r.File("/sitemap.xml", filepath.Join(dir, "sitemap.xml"))
+	r.File("/.well-known/security.txt", filepath.Join(dir, ".well-known/security.txt"))
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{"/robots.txt", "text/plain; charset=utf-8", "User-agent: *\nDisallow:\n"},
+		{"/sitemap.xml", "text/xml; charset=utf-8", "<urlset/>"},
+		{"/.well-known/security.txt", "text/plain; charset=utf-8", "Contact: mailto:security@example.com\n"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != http.StatusOK || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q", tt.path, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.path, got, tt.contentType)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("If-Modified-Since", w.Header().Get("Last-Modified"))
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("%s: expected 304 for a conditional request, got %d", tt.path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/robots.txt", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected File routes to be GET only, got %d", w.Code)
+	}
+}
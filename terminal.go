@@ -2,6 +2,8 @@ package router
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"time"
 )
 
@@ -67,6 +69,14 @@ func printServerInfo(serverName string, serverVersion string, port int) {
 	fmt.Println(info)
 }
 
+func (r *Router) logServerStart(addr string, port int) {
+	if l := r.customLogger(); l != nil {
+		l.Info("server started", "name", serverName, "version", serverVersion, "addr", addr)
+		return
+	}
+	printServerInfo(serverName, serverVersion, port)
+}
+
 func terminalOutput(path string, method string, message any, errors string) {
 	fmt.Printf("\n%s\n%s [%s]\n%s [%s]\n%s %s\n%s",
 		getTextColor("green")+time.Now().Format("2006-01-02 15:04:05")+"\033[0m",
@@ -76,6 +86,10 @@ func terminalOutput(path string, method string, message any, errors string) {
 }
 
 func Log(level string, message string, args ...any) {
+	logTo(os.Stdout, level, message, args...)
+}
+
+func logTo(out io.Writer, level string, message string, args ...any) {
 	var color string
 
 	switch level {
@@ -94,7 +108,7 @@ func Log(level string, message string, args ...any) {
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	formattedMessage := fmt.Sprintf(message, args...)
 
-	fmt.Printf("› %s %s %s\n",
+	_, _ = fmt.Fprintf(out, "› %s %s %s\n",
 		getTextColor("green")+timestamp+"\033[0m",
 		colors(color, fmt.Sprintf("[%s]", level)),
 		formattedMessage)
@@ -0,0 +1,70 @@
+package router
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+func ClientCertTLSConfig(clientCAs *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// tlsConfig loads the listener's certificate up front so a bad key pair fails
+// before anything is bound. It returns nil for plain HTTP listeners and
+// rejects TLS settings without a CertFile instead of serving them unencrypted.
+func (ln Listener) tlsConfig() (*tls.Config, error) {
+	if ln.CertFile == "" {
+		if ln.KeyFile != "" || ln.ClientCAs != nil {
+			return nil, fmt.Errorf("router: listener %s sets KeyFile or ClientCAs without CertFile", ln.Listen)
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(ln.CertFile, ln.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("router: listener %s: %w", ln.Listen, err)
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ln.ClientCAs != nil {
+		cfg = ClientCertTLSConfig(ln.ClientCAs)
+	}
+	cfg.Certificates = []tls.Certificate{cert}
+
+	return cfg, nil
+}
+
+func (r *Router) serveListener(server *http.Server, l net.Listener, cfg *tls.Config) error {
+	if cfg == nil {
+		return server.Serve(l)
+	}
+
+	server.TLSConfig = cfg
+	return server.ServeTLS(l, "", "")
+}
+
+func (c *Context) ClientCert() *x509.Certificate {
+	if c.Request == nil || c.Request.TLS == nil {
+		return nil
+	}
+
+	if chains := c.Request.TLS.VerifiedChains; len(chains) > 0 && len(chains[0]) > 0 {
+		return chains[0][0]
+	}
+
+	return nil
+}
+
+func (c *Context) ClientCertSubject() string {
+	if cert := c.ClientCert(); cert != nil {
+		return cert.Subject.String()
+	}
+	return ""
+}
@@ -0,0 +1,169 @@
+package router
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func (c testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *testCert) testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	parentCert, parentKey := tmpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	return testCert{cert: cert, key: key, der: der}
+}
+
+func TestClientCertAuthentication(t *testing.T) {
+	ca := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+
+	server := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, &ca)
+
+	client := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "billing-service", Organization: []string{"NetLifeGuru"}},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, &ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	r := NewRouter().(*Router)
+	r.HandleFunc("/whoami", "GET", func(w http.ResponseWriter, _ *http.Request, ctx *Context) {
+		_, _ = w.Write([]byte(ctx.ClientCertSubject()))
+	})
+
+	srv := httptest.NewUnstartedServer(r)
+	srv.TLS = ClientCertTLSConfig(pool)
+	srv.TLS.Certificates = []tls.Certificate{server.tlsCertificate()}
+	srv.StartTLS()
+	defer srv.Close()
+
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{client.tlsCertificate()},
+	}}}
+
+	resp, err := httpClient.Get(srv.URL + "/whoami")
+	if err != nil {
+		t.Fatalf("request with client certificate failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if got, want := string(body), "CN=billing-service,O=NetLifeGuru"; got != want {
+		t.Fatalf("client subject = %q, want %q", got, want)
+	}
+
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	if resp, err := anonymous.Get(srv.URL + "/whoami"); err == nil {
+		_ = resp.Body.Close()
+		t.Fatalf("expected a request without a client certificate to be rejected")
+	}
+}
+
+func TestListenerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	cert := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, nil)
+	keyDER, err := x509.MarshalECPrivateKey(cert.key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.der}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.cert)
+
+	cfg, err := Listener{Listen: "127.0.0.1:8443", CertFile: certFile, KeyFile: keyFile, ClientCAs: pool}.tlsConfig()
+	if err != nil || len(cfg.Certificates) != 1 || cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Fatalf("expected an mTLS config with the loaded certificate, got %+v, %v", cfg, err)
+	}
+
+	if cfg, err := (Listener{Listen: "127.0.0.1:8080"}).tlsConfig(); cfg != nil || err != nil {
+		t.Fatalf("expected no TLS config for a plain listener, got %+v, %v", cfg, err)
+	}
+
+	invalid := []Listener{
+		{Listen: "127.0.0.1:0", KeyFile: keyFile},
+		{Listen: "127.0.0.1:0", ClientCAs: pool},
+		{Listen: "127.0.0.1:0", CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile},
+		{Listen: "127.0.0.1:0", CertFile: keyFile, KeyFile: certFile},
+	}
+	for _, ln := range invalid {
+		if _, err := ln.tlsConfig(); err == nil {
+			t.Errorf("expected %+v to be rejected", ln)
+		}
+
+		r := NewRouter().(*Router)
+		r.TerminalOutput(false)
+		if err := r.Serve(context.Background(), Listeners{ln}); err == nil {
+			t.Errorf("expected Serve to fail before binding for %+v", ln)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package router
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+var ErrHandlerPanicked = errors.New("router: handler panicked")
+
+type Tracer interface {
+	Start(ctx context.Context, spanName string, req *http.Request) (context.Context, Span)
+}
+
+type Span interface {
+	TraceParent() TraceParent
+	SetStatus(code int)
+	RecordError(err error)
+	End()
+}
+
+type TraceParent struct {
+	TraceID    string
+	ParentID   string
+	Flags      byte
+	TraceState string
+}
+
+type traceParentKey struct{}
+
+func ParseTraceParent(header string) (TraceParent, bool) {
+	header = strings.TrimSpace(header)
+	if len(header) < 55 || header[2] != '-' || header[35] != '-' || header[52] != '-' {
+		return TraceParent{}, false
+	}
+
+	version, traceID, parentID, flags := header[:2], header[3:35], header[36:52], header[53:55]
+	if !isLowerHex(version) || version == "ff" || (version == "00" && len(header) != 55) {
+		return TraceParent{}, false
+	}
+	if len(header) > 55 && header[55] != '-' {
+		return TraceParent{}, false
+	}
+	if !isLowerHex(traceID) || !isLowerHex(parentID) || !isLowerHex(flags) {
+		return TraceParent{}, false
+	}
+	if isAllZeros(traceID) || isAllZeros(parentID) {
+		return TraceParent{}, false
+	}
+
+	var f [1]byte
+	_, _ = hex.Decode(f[:], []byte(flags))
+
+	return TraceParent{TraceID: traceID, ParentID: parentID, Flags: f[0]}, true
+}
+
+func (tp TraceParent) Valid() bool {
+	return len(tp.TraceID) == 32 && len(tp.ParentID) == 16 &&
+		isLowerHex(tp.TraceID) && isLowerHex(tp.ParentID) &&
+		!isAllZeros(tp.TraceID) && !isAllZeros(tp.ParentID)
+}
+
+func (tp TraceParent) Sampled() bool {
+	return tp.Flags&0x01 != 0
+}
+
+func (tp TraceParent) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tp.TraceID, tp.ParentID, tp.Flags)
+}
+
+func ContextWithTraceParent(ctx context.Context, tp TraceParent) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, tp)
+}
+
+func TraceParentFromContext(ctx context.Context) (TraceParent, bool) {
+	tp, ok := ctx.Value(traceParentKey{}).(TraceParent)
+	return tp, ok
+}
+
+func InjectTraceParent(ctx context.Context, h http.Header) {
+	tp, ok := TraceParentFromContext(ctx)
+	if !ok || !tp.Valid() {
+		return
+	}
+
+	h.Set(HeaderTraceParent, tp.String())
+	if tp.TraceState != "" {
+		h.Set(HeaderTraceState, tp.TraceState)
+	}
+}
+
+func Tracing(tracer Tracer) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, c *Context) {
+			parent := r.Context()
+			if tp, ok := ParseTraceParent(r.Header.Get(HeaderTraceParent)); ok {
+				tp.TraceState = r.Header.Get(HeaderTraceState)
+				parent = ContextWithTraceParent(parent, tp)
+			}
+
+			spanCtx, span := tracer.Start(parent, spanName(r.Method, c.Route()), r)
+			if tp := span.TraceParent(); tp.Valid() {
+				if tp.TraceState == "" {
+					if incoming, ok := TraceParentFromContext(parent); ok {
+						tp.TraceState = incoming.TraceState
+					}
+				}
+				spanCtx = ContextWithTraceParent(spanCtx, tp)
+			}
+
+			r = r.WithContext(spanCtx)
+			c.Request = r
+
+			completed := false
+			c.OnComplete(func() {
+				if !completed {
+					err := ErrHandlerPanicked
+					if p := c.Get("panic"); p != nil {
+						err = fmt.Errorf("%w: %v", ErrHandlerPanicked, p)
+					}
+					span.RecordError(err)
+				}
+
+				status := c.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				span.SetStatus(status)
+				span.End()
+			})
+
+			next(w, r, c)
+			completed = true
+		}
+	}
+}
+
+func spanName(method, route string) string {
+	if route == "" {
+		return method
+	}
+	return method + " " + route
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAllZeros(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '0' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+type recordedSpan struct {
+	name   string
+	parent TraceParent
+	self   TraceParent
+	status int
+	errs   []error
+	ended  bool
+}
+
+func (s *recordedSpan) TraceParent() TraceParent { return s.self }
+func (s *recordedSpan) SetStatus(code int)       { s.status = code }
+func (s *recordedSpan) RecordError(err error)    { s.errs = append(s.errs, err) }
+func (s *recordedSpan) End()                     { s.ended = true }
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, req *http.Request) (context.Context, Span) {
+	span := &recordedSpan{name: name}
+	span.parent, _ = TraceParentFromContext(ctx)
+
+	span.self = TraceParent{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ParentID: "00f067aa0ba902b7", Flags: 1}
+	if span.parent.Valid() {
+		span.self.TraceID = span.parent.TraceID
+	}
+
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		header string
+		ok     bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		tp, ok := ParseTraceParent(tt.header)
+		if ok != tt.ok {
+			t.Errorf("ParseTraceParent(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+			continue
+		}
+		if ok && tt.header[:2] == "00" && tp.String() != tt.header {
+			t.Errorf("round trip: got %q, want %q", tp.String(), tt.header)
+		}
+	}
+}
+
+func TestTracingNamesSpansByRouteTemplate(t *testing.T) {
+	tracer := &recordingTracer{}
+
+	r := NewRouter().(*Router)
+	r.Use(Tracing(tracer))
+
+	var outgoing http.Header
+	r.HandleFunc("/users/<id:isDigits>", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		outgoing = http.Header{}
+		InjectTraceParent(req.Context(), outgoing)
+		w.WriteHeader(http.StatusCreated)
+	})
+	r.HandleFunc("/health", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {})
+
+	for _, path := range []string{"/users/1", "/users/2", "/health"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(HeaderTraceParent, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		req.Header.Set(HeaderTraceState, "vendor=abc")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(tracer.spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(tracer.spans))
+	}
+
+	names := []string{tracer.spans[0].name, tracer.spans[1].name, tracer.spans[2].name}
+	if names[0] != "GET /users/<id:isDigits>" || names[1] != names[0] || names[2] != "GET /health" {
+		t.Fatalf("unexpected span names: %v", names)
+	}
+
+	first := tracer.spans[0]
+	if first.parent.ParentID != "b7ad6b7169203331" || first.parent.TraceState != "vendor=abc" {
+		t.Fatalf("expected the incoming traceparent as parent, got %+v", first.parent)
+	}
+	if first.status != http.StatusCreated || !first.ended || len(first.errs) != 0 {
+		t.Fatalf("unexpected span state: %+v", first)
+	}
+	if got := tracer.spans[2].status; got != http.StatusOK {
+		t.Fatalf("expected an implicit 200 status, got %d", got)
+	}
+
+	want := "00-0af7651916cd43dd8448eb211c80319c-00f067aa0ba902b7-01"
+	if got := outgoing.Get(HeaderTraceParent); got != want {
+		t.Fatalf("expected the span context to be propagated as %q, got %q", want, got)
+	}
+	if got := outgoing.Get(HeaderTraceState); got != "vendor=abc" {
+		t.Fatalf("expected tracestate to be propagated, got %q", got)
+	}
+}
+
+func TestTracingRecordsPanics(t *testing.T) {
+	defer os.RemoveAll("./logs")
+
+	tracer := &recordingTracer{}
+
+	r := NewRouter().(*Router)
+	r.TerminalOutput(false)
+	r.Recovery(func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	r.Use(Tracing(tracer))
+	r.HandleFunc("/boom", "GET", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		panic("kaboom")
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(tracer.spans))
+	}
+
+	span := tracer.spans[0]
+	if !span.ended || span.status != http.StatusInternalServerError {
+		t.Fatalf("expected an ended span with status 500, got %+v", span)
+	}
+	if len(span.errs) != 1 || !errors.Is(span.errs[0], ErrHandlerPanicked) || span.errs[0].Error() != "router: handler panicked: kaboom" {
+		t.Fatalf("expected the panic to be recorded, got %v", span.errs)
+	}
+}
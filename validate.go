@@ -0,0 +1,227 @@
+package router
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + " " + f.Message
+	}
+	return "router: validation failed: " + strings.Join(parts, "; ")
+}
+
+var validationRegexCache sync.Map
+
+func ValidateStruct(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	ve := &ValidationError{}
+	if err := validateStruct(rv, "", ve); err != nil {
+		return err
+	}
+	if len(ve.Fields) > 0 {
+		return ve
+	}
+	return nil
+}
+
+func validateStruct(sv reflect.Value, prefix string, ve *ValidationError) error {
+	st := sv.Type()
+
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		fv := sv.Field(i)
+
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+
+		name := prefix + fieldName(sf)
+		if sf.Anonymous {
+			name = strings.TrimSuffix(prefix, ".")
+		}
+
+		if rules, ok := sf.Tag.Lookup("validate"); ok && rules != "" && rules != "-" {
+			if err := validateField(fv, name, rules, ve); err != nil {
+				return err
+			}
+		}
+
+		nested := fv
+		if nested.Kind() == reflect.Pointer && !nested.IsNil() {
+			nested = nested.Elem()
+		}
+		if nested.Kind() == reflect.Struct {
+			nestedPrefix := name + "."
+			if sf.Anonymous {
+				nestedPrefix = prefix
+			}
+			if err := validateStruct(nested, nestedPrefix, ve); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func fieldName(sf reflect.StructField) string {
+	for _, tag := range []string{"json", "query", "form", "xml"} {
+		if name, _, _ := strings.Cut(sf.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+func validateField(fv reflect.Value, name string, rules string, ve *ValidationError) error {
+	for rules != "" {
+		var rule string
+		if strings.HasPrefix(rules, "regex=") {
+			rule, rules = rules, ""
+		} else {
+			rule, rules, _ = strings.Cut(rules, ",")
+		}
+
+		rule = strings.TrimSpace(rule)
+		key, param, _ := strings.Cut(rule, "=")
+
+		switch key {
+		case "":
+			continue
+		case "omitempty":
+			if fv.IsZero() {
+				return nil
+			}
+			continue
+		case "required":
+			if fv.IsZero() {
+				ve.Fields = append(ve.Fields, FieldError{Field: name, Rule: key, Message: "is required"})
+				return nil
+			}
+			continue
+		}
+
+		v := fv
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+
+		msg, err := checkRule(v, key, param)
+		if err != nil {
+			return fmt.Errorf("router: field %s: %w", name, err)
+		}
+		if msg != "" {
+			ve.Fields = append(ve.Fields, FieldError{Field: name, Rule: key, Param: param, Message: msg})
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func checkRule(v reflect.Value, key, param string) (string, error) {
+	switch key {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s parameter %q", key, param)
+		}
+
+		size, unit, ok := measure(v)
+		if !ok {
+			return "", fmt.Errorf("%s is not supported for %s", key, v.Type())
+		}
+
+		if key == "min" && size < limit {
+			return "must be at least " + param + unit, nil
+		}
+		if key == "max" && size > limit {
+			return "must be at most " + param + unit, nil
+		}
+	case "email":
+		if v.Kind() != reflect.String {
+			return "", fmt.Errorf("email is not supported for %s", v.Type())
+		}
+		if addr, err := mail.ParseAddress(v.String()); err != nil || addr.Address != v.String() {
+			return "must be a valid email address", nil
+		}
+	case "regex":
+		if v.Kind() != reflect.String {
+			return "", fmt.Errorf("regex is not supported for %s", v.Type())
+		}
+		re, err := validationRegex(param)
+		if err != nil {
+			return "", err
+		}
+		if !re.MatchString(v.String()) {
+			return "must match " + param, nil
+		}
+	default:
+		return "", fmt.Errorf("unknown validation rule %q", key)
+	}
+
+	return "", nil
+}
+
+func measure(v reflect.Value) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+	return 0, "", false
+}
+
+func validationRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := validationRegexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", pattern, err)
+	}
+
+	validationRegexCache.Store(pattern, re)
+	return re, nil
+}
@@ -0,0 +1,123 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"regex=^[0-9]{3,5}$"`
+}
+
+type createUser struct {
+	Name     string   `json:"name" validate:"required,min=3,max=20"`
+	Email    string   `json:"email" validate:"required,email"`
+	Age      int      `json:"age" validate:"min=18"`
+	Nickname *string  `json:"nickname" validate:"min=2"`
+	Website  string   `json:"website" validate:"omitempty,regex=^https://"`
+	Tags     []string `json:"tags" validate:"max=2"`
+	Address  address  `json:"address"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	valid := createUser{Name: "Ada", Email: "ada@example.com", Age: 36, Address: address{City: "London", Zip: "1234"}}
+	if err := ValidateStruct(&valid); err != nil {
+		t.Fatalf("expected a valid struct, got %v", err)
+	}
+
+	short := "x"
+	invalid := createUser{
+		Name:     "Al",
+		Email:    "Al <al@example.com>",
+		Age:      17,
+		Nickname: &short,
+		Website:  "http://example.com",
+		Tags:     []string{"a", "b", "c"},
+		Address:  address{Zip: "12a"},
+	}
+
+	err := ValidateStruct(&invalid)
+
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+
+	want := []FieldError{
+		{Field: "name", Rule: "min", Param: "3", Message: "must be at least 3 characters"},
+		{Field: "email", Rule: "email", Message: "must be a valid email address"},
+		{Field: "age", Rule: "min", Param: "18", Message: "must be at least 18"},
+		{Field: "nickname", Rule: "min", Param: "2", Message: "must be at least 2 characters"},
+		{Field: "website", Rule: "regex", Param: "^https://", Message: "must match ^https://"},
+		{Field: "tags", Rule: "max", Param: "2", Message: "must be at most 2 items"},
+		{Field: "address.city", Rule: "required", Message: "is required"},
+		{Field: "address.zip", Rule: "regex", Param: "^[0-9]{3,5}$", Message: "must match ^[0-9]{3,5}$"},
+	}
+	if len(ve.Fields) != len(want) {
+		t.Fatalf("expected %d field errors, got %+v", len(want), ve.Fields)
+	}
+	for i := range want {
+		if ve.Fields[i] != want[i] {
+			t.Errorf("field error %d: got %+v, want %+v", i, ve.Fields[i], want[i])
+		}
+	}
+}
+
+func TestValidateStructUnknownRule(t *testing.T) {
+	var v struct {
+		Age int `json:"age" validate:"gte=1"`
+	}
+
+	err := ValidateStruct(&v)
+
+	var ve *ValidationError
+	if err == nil || errors.As(err, &ve) || !strings.Contains(err.Error(), `unknown validation rule "gte"`) {
+		t.Fatalf("expected a configuration error for an unknown rule, got %v", err)
+	}
+}
+
+func TestBindersValidateAndJSONErrorRenders400(t *testing.T) {
+	r := NewRouter().(*Router)
+	r.HandleFunc("/users", "POST", func(w http.ResponseWriter, req *http.Request, ctx *Context) {
+		var in createUser
+		if JSONError(w, req, "invalid user", BindJSON(req, &in)) {
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	body := `{"name":"Ada","email":"not-an-email","age":36,"address":{"city":"London","zip":"1234"}}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Message    string       `json:"message"`
+		StatusCode int          `json:"statusCode"`
+		Fields     []FieldError `json:"fields"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || len(resp.Fields) != 1 || resp.Fields[0].Field != "email" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	var q struct {
+		Page int `query:"page" validate:"min=1"`
+	}
+	err := BindQuery(httptest.NewRequest(http.MethodGet, "/?page=0", nil), &q)
+
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Fields[0].Field != "page" {
+		t.Fatalf("expected BindQuery to validate, got %v", err)
+	}
+}